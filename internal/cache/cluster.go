@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog"
+)
+
+// the number of hash slots a Redis Cluster splits its keyspace into
+const clusterSlots = 16384
+
+// the most per-slot batches fanOut sends at once; keys spread over
+// thousands of slots shouldn't mean thousands of goroutines and a
+// connection pool drained by one request
+const maxFanOut = 16
+
+// HashTag wraps tag in braces so Redis Cluster hashes only the tag when
+// working out a key's slot. Keys built as HashTag("user:42") + ":profile"
+// and HashTag("user:42") + ":settings" always land on the same node, which
+// is what lets a single command or script work on both of them.
+func HashTag(tag string) string {
+	return "{" + tag + "}"
+}
+
+// work out which cluster slot a key belongs to, honouring hash tags the
+// same way Redis does: if the key has a non-empty {...} section, only the
+// part between the first { and the next } is hashed
+func keySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % clusterSlots)
+}
+
+// the CRC16 variant (XMODEM) Redis Cluster uses for key slots
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// report whether we're talking to a Redis Cluster
+func (d *Database) isCluster() bool {
+	_, ok := d.Client.(*redis.ClusterClient)
+	return ok
+}
+
+// run fn over keys in batches that are safe to send as one command. A
+// cluster refuses multi-key commands that span slots with CROSSSLOT, so
+// there we send one batch per slot, up to maxFanOut at a time; anywhere
+// else all the keys go in a single batch.
+func (d *Database) fanOut(ctx context.Context, keys []string, fn func(ctx context.Context, keys []string) error) error {
+	if !d.isCluster() {
+		return fn(ctx, keys)
+	}
+
+	batches := make(map[int][]string)
+	for _, key := range keys {
+		slot := keySlot(key)
+		batches[slot] = append(batches[slot], key)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, maxFanOut)
+	for _, batch := range batches {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(batch []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, batch); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(batch)
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// GetMany fetches several keys at once. Keys that don't exist are left
+// out of the result rather than returned as errors.
+func (d *Database) GetMany(ctx context.Context, keys ...string) (map[string]string, error) {
+	klog.Infof("Fetching [%d] keys from the Redis cache...", len(keys))
+
+	var mu sync.Mutex
+	results := make(map[string]string, len(keys))
+
+	err := d.fanOut(ctx, keys, func(ctx context.Context, batch []string) error {
+		values, err := d.Client.MGet(ctx, batch...).Result()
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for i, v := range values {
+			if s, ok := v.(string); ok {
+				results[batch[i]] = s
+			}
+		}
+		return nil
+	})
+
+	return results, err
+}
+
+// DeleteMany removes several keys at once and returns how many of them
+// actually existed
+func (d *Database) DeleteMany(ctx context.Context, keys ...string) (int64, error) {
+	klog.Infof("Deleting [%d] keys from the Redis cache...", len(keys))
+
+	var mu sync.Mutex
+	var deleted int64
+
+	err := d.fanOut(ctx, keys, func(ctx context.Context, batch []string) error {
+		n, err := d.Client.Del(ctx, batch...).Result()
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		deleted += n
+		return nil
+	})
+
+	return deleted, err
+}
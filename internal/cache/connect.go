@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// work out how long to wait before retry number attempt (counting from
+// zero): the delay doubles every attempt up to max, and then we pick a
+// random point in its upper half, so a fleet of pods that all lost Redis
+// at once don't all come knocking again at the same moment
+func backoff(attempt int, min time.Duration, max time.Duration) time.Duration {
+	delay := min
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// WaitForStore pings store until it answers, backing off exponentially
+// with jitter between attempts. It gives up, returning the last error,
+// once ctx is done; callers put their maximum wait on ctx.
+func WaitForStore(ctx context.Context, store Store, minBackoff time.Duration, maxBackoff time.Duration) error {
+	for attempt := 0; ; attempt++ {
+		_, err := store.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+
+		delay := backoff(attempt, minBackoff, maxBackoff)
+		klog.Warningf("Cache backend not available on attempt %d, retrying in %v: %s", attempt+1, delay, err.Error())
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Gave up waiting for the cache backend after %d attempts: %w", attempt+1, err)
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog"
+)
+
+// NotANumberError is returned when incrementing a key whose value isn't a
+// number Redis can add to.
+type NotANumberError struct {
+	Key string
+}
+
+func (e *NotANumberError) Error() string {
+	return fmt.Sprintf("The value of key [%s] is not a number", e.Key)
+}
+
+// OverflowError is returned when an increment would take a counter past
+// what it can hold.
+type OverflowError struct {
+	Key string
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("Incrementing key [%s] would overflow it", e.Key)
+}
+
+// add to the counter, and give it a TTL if this is what created it. A
+// counter that already existed keeps whatever expiry it had, so counting
+// into it never pushes its window out.
+var incrByScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1])
+local value = redis.call('INCRBY', KEYS[1], ARGV[1])
+if existed == 0 and tonumber(ARGV[2]) > 0 then
+  redis.call('EXPIRE', KEYS[1], ARGV[2])
+end
+return value
+`)
+
+// the same for fractional deltas; INCRBYFLOAT answers with a string,
+// which is what we want anyway, as Lua would round a number to an integer
+var incrByFloatScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1])
+local value = redis.call('INCRBYFLOAT', KEYS[1], ARGV[1])
+if existed == 0 and tonumber(ARGV[2]) > 0 then
+  redis.call('EXPIRE', KEYS[1], ARGV[2])
+end
+return value
+`)
+
+// Redis tells us a value can't be incremented with an error reply; turn
+// that into something callers can check for. It says "not an integer or
+// out of range" both for values that aren't integers and for deltas that
+// don't fit in one, but our deltas are always int64s, so that only ever
+// means the former. A key holding a hash is a WrongTypeError, the same
+// as for the hash operations.
+func counterError(key string, err error) error {
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		msg := redisErr.Error()
+		switch {
+		case strings.Contains(msg, "overflow"), strings.Contains(msg, "NaN or Infinity"):
+			return &OverflowError{Key: key}
+		case strings.Contains(msg, "not an integer"), strings.Contains(msg, "not a valid float"):
+			return &NotANumberError{Key: key}
+		}
+	}
+	return hashError(key, err)
+}
+
+// Incr adds one to the counter at key. A counter that doesn't exist
+// starts at zero and, if expiration is above zero, expires after that
+// many seconds.
+func (d *Database) Incr(ctx context.Context, key string, expiration int) (int64, error) {
+	return d.IncrBy(ctx, key, 1, expiration)
+}
+
+// Decr takes one from the counter at key, like Incr.
+func (d *Database) Decr(ctx context.Context, key string, expiration int) (int64, error) {
+	return d.IncrBy(ctx, key, -1, expiration)
+}
+
+// IncrBy adds delta to the counter at key, returning the new value. The
+// expiration, in seconds, only applies when this creates the counter.
+func (d *Database) IncrBy(ctx context.Context, key string, delta int64, expiration int) (int64, error) {
+	klog.Info(fmt.Sprintf("Incrementing key [%s] by [%d] with a TTL of [%v] if new in the Redis cache...", key, delta, time.Duration(expiration)*time.Second))
+	value, err := incrByScript.Run(ctx, d.Client, []string{key}, delta, expiration).Int64()
+	if err != nil {
+		return 0, counterError(key, err)
+	}
+	return value, nil
+}
+
+// IncrByFloat adds a fractional delta to the counter at key, like IncrBy.
+func (d *Database) IncrByFloat(ctx context.Context, key string, delta float64, expiration int) (float64, error) {
+	klog.Info(fmt.Sprintf("Incrementing key [%s] by [%v] with a TTL of [%v] if new in the Redis cache...", key, delta, time.Duration(expiration)*time.Second))
+	reply, err := incrByFloatScript.Run(ctx, d.Client, []string{key}, strconv.FormatFloat(delta, 'f', -1, 64), expiration).Text()
+	if err != nil {
+		return 0, counterError(key, err)
+	}
+	return strconv.ParseFloat(reply, 64)
+}
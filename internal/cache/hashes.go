@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog"
+)
+
+// FieldNotFoundError is returned when a hash doesn't have the field asked
+// for, or doesn't exist at all. Like NotFoundError it matches ErrNil.
+type FieldNotFoundError struct {
+	Key   string
+	Field string
+}
+
+func (e *FieldNotFoundError) Error() string {
+	return fmt.Sprintf("No field [%s] found for key [%s]", e.Field, e.Key)
+}
+
+func (e *FieldNotFoundError) Is(target error) bool {
+	return target == ErrNil
+}
+
+// WrongTypeError is returned when a key holds a different kind of value
+// than the operation works on, e.g. a string where we wanted a hash.
+type WrongTypeError struct {
+	Key string
+}
+
+func (e *WrongTypeError) Error() string {
+	return fmt.Sprintf("Key [%s] holds the wrong kind of value for this operation", e.Key)
+}
+
+// Redis answers WRONGTYPE when a key holds some other kind of value, be
+// that a string where we wanted a hash or a hash where we wanted a string
+func hashError(key string, err error) error {
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) && strings.Contains(redisErr.Error(), "WRONGTYPE") {
+		return &WrongTypeError{Key: key}
+	}
+	return err
+}
+
+// set the given fields, leaving the others alone, then answer the whole
+// hash. ARGV[1] is the TTL in seconds and ARGV[2] is 1 when a hash that
+// already exists should keep the expiry it has; the fields and values
+// follow. We HSET them a pair at a time rather than unpacking them all
+// into one call, which Lua limits to a few thousand arguments.
+var updateHashScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1])
+for i = 3, #ARGV, 2 do
+  redis.call('HSET', KEYS[1], ARGV[i], ARGV[i + 1])
+end
+if existed == 0 or ARGV[2] ~= '1' then
+  local ttl = tonumber(ARGV[1])
+  if ttl > 0 then
+    redis.call('EXPIRE', KEYS[1], ttl)
+  else
+    redis.call('PERSIST', KEYS[1])
+  end
+end
+return redis.call('HGETALL', KEYS[1])
+`)
+
+// delete the key only if it holds a hash, answering WRONGTYPE the way a
+// hash command would if it holds something else. Checking and deleting in
+// one script means nobody can swap the value out in between.
+var deleteHashScript = redis.NewScript(`
+local kind = redis.call('TYPE', KEYS[1]).ok
+if kind == 'none' then
+  return 0
+end
+if kind ~= 'hash' then
+  return redis.error_reply('WRONGTYPE Operation against a key holding the wrong kind of value')
+end
+return redis.call('DEL', KEYS[1])
+`)
+
+// HGet returns one field of the hash at key.
+func (d *Database) HGet(ctx context.Context, key string, field string) (string, error) {
+	klog.Info(fmt.Sprintf("Fetching field [%s] of key [%s] from the Redis cache...", field, key))
+	result, err := d.Client.HGet(ctx, key, field).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", &FieldNotFoundError{Key: key, Field: field}
+	}
+	return result, hashError(key, err)
+}
+
+// HGetAll returns every field of the hash at key.
+func (d *Database) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	klog.Info(fmt.Sprintf("Fetching hash [%s] from the Redis cache...", key))
+	result, err := d.Client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, hashError(key, err)
+	}
+	// Redis doesn't keep empty hashes, so no fields means no key
+	if len(result) == 0 {
+		return nil, &NotFoundError{Key: key}
+	}
+	return result, nil
+}
+
+// ReplaceHash sets the hash at key to exactly the given fields, dropping
+// any others, with a TTL of expiration seconds if that's above zero.
+func (d *Database) ReplaceHash(ctx context.Context, key string, fields map[string]string, expiration int) error {
+	klog.Info(fmt.Sprintf("Writing hash [%s] with [%d] fields and TTL of [%v] seconds to Redis cache...", key, len(fields), time.Duration(expiration)*time.Second))
+	_, err := d.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, fields)
+		if expiration > 0 {
+			pipe.Expire(ctx, key, time.Duration(expiration)*time.Second)
+		}
+		return nil
+	})
+	return hashError(key, err)
+}
+
+// UpdateHash sets the given fields of the hash at key, creating it if
+// needed, and returns every field it has afterwards. The hash expires in
+// expiration seconds, or never if that's zero; with keepTTL set that only
+// applies to a new hash, and one that already exists keeps its expiry.
+func (d *Database) UpdateHash(ctx context.Context, key string, fields map[string]string, expiration int, keepTTL bool) (map[string]string, error) {
+	klog.Info(fmt.Sprintf("Updating [%d] fields of hash [%s] in the Redis cache...", len(fields), key))
+	keep := "0"
+	if keepTTL {
+		keep = "1"
+	}
+	args := []interface{}{expiration, keep}
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+
+	reply, err := updateHashScript.Run(ctx, d.Client, []string{key}, args...).StringSlice()
+	if err != nil {
+		return nil, hashError(key, err)
+	}
+
+	result := make(map[string]string, len(reply)/2)
+	for i := 0; i+1 < len(reply); i += 2 {
+		result[reply[i]] = reply[i+1]
+	}
+	return result, nil
+}
+
+// HDel removes fields from the hash at key, returning how many it had.
+func (d *Database) HDel(ctx context.Context, key string, fields ...string) (int64, error) {
+	klog.Info(fmt.Sprintf("Deleting fields %v of key [%s] from the Redis cache...", fields, key))
+	n, err := d.Client.HDel(ctx, key, fields...).Result()
+	return n, hashError(key, err)
+}
+
+// DeleteHash removes the hash at key, returning 1 if it existed. A key
+// holding anything else is left alone and is a WrongTypeError.
+func (d *Database) DeleteHash(ctx context.Context, key string) (int64, error) {
+	klog.Info(fmt.Sprintf("Deleting hash [%s] from the Redis cache...", key))
+	n, err := deleteHashScript.Run(ctx, d.Client, []string{key}).Int64()
+	return n, hashError(key, err)
+}
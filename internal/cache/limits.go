@@ -0,0 +1,273 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog"
+)
+
+// Bucket describes a token bucket: it holds up to Burst tokens and
+// refills at Rate tokens per second, so a client can burst up to Burst
+// requests and then keep going at Rate.
+type Bucket struct {
+	Rate  float64
+	Burst int64
+}
+
+// BucketResult is the outcome of taking a token from a bucket.
+// RetryAfter is how long until the next token, if none was left, and
+// ResetAfter how long until the bucket is full again.
+type BucketResult struct {
+	Allowed    bool
+	Remaining  int64
+	RetryAfter time.Duration
+	ResetAfter time.Duration
+}
+
+// QuotaResult is the outcome of consuming part of a quota. ResetAfter is
+// how long until the quota's window ends and it starts again from zero.
+type QuotaResult struct {
+	Allowed    bool
+	Used       int64
+	Remaining  int64
+	ResetAfter time.Duration
+}
+
+// Limiter is the set of operations used to throttle clients. The Redis
+// backed Database shares limits across every replica; MemoryLimiter keeps
+// them per process.
+type Limiter interface {
+	TakeToken(ctx context.Context, key string, bucket Bucket) (BucketResult, error)
+	ConsumeQuota(ctx context.Context, key string, n int64, limit int64, window time.Duration) (QuotaResult, error)
+}
+
+var (
+	_ Limiter = (*Database)(nil)
+	_ Limiter = (*MemoryLimiter)(nil)
+)
+
+// refill the bucket for the time since we last looked at it, then take a
+// token if there's one to take. The state lives in a hash of tokens and
+// the timestamp we last refilled at; we use Redis' clock rather than ours,
+// so replicas with skewed clocks still agree. Lua turns fractional numbers
+// into integers on the way out, hence returning them as strings.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = (1 - tokens) / rate
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', now)
+redis.call('EXPIRE', KEYS[1], math.ceil(burst / rate) + 1)
+
+return {allowed, tostring(tokens), tostring(retry), tostring((burst - tokens) / rate)}
+`)
+
+// add n to a counter unless that would take it over the limit; the
+// counter expires at the end of its window, which also resets it
+var quotaScript = redis.NewScript(`
+local n = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+
+local used = tonumber(redis.call('GET', KEYS[1]) or '0')
+if used + n > limit then
+  return {0, used, redis.call('PTTL', KEYS[1])}
+end
+
+used = redis.call('INCRBY', KEYS[1], n)
+if used == n then
+  redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+
+return {1, used, redis.call('PTTL', KEYS[1])}
+`)
+
+// seconds, as a float, to a time.Duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// TakeToken takes a token from the bucket stored at key, refilling it
+// first for the time that's passed.
+func (d *Database) TakeToken(ctx context.Context, key string, bucket Bucket) (BucketResult, error) {
+	klog.Info(fmt.Sprintf("Taking a token from bucket [%s] in the Redis cache...", key))
+	reply, err := tokenBucketScript.Run(ctx, d.Client, []string{key}, bucket.Rate, bucket.Burst).Slice()
+	if err != nil {
+		return BucketResult{}, err
+	}
+
+	allowed, _ := reply[0].(int64)
+	tokens, _ := strconv.ParseFloat(reply[1].(string), 64)
+	retry, _ := strconv.ParseFloat(reply[2].(string), 64)
+	reset, _ := strconv.ParseFloat(reply[3].(string), 64)
+
+	return BucketResult{
+		Allowed:    allowed == 1,
+		Remaining:  int64(math.Floor(tokens)),
+		RetryAfter: seconds(retry),
+		ResetAfter: seconds(reset),
+	}, nil
+}
+
+// ConsumeQuota adds n to the quota counter at key, unless that would
+// take it over limit. A new counter lasts for window.
+func (d *Database) ConsumeQuota(ctx context.Context, key string, n int64, limit int64, window time.Duration) (QuotaResult, error) {
+	klog.Info(fmt.Sprintf("Consuming [%d] of quota [%s] in the Redis cache...", n, key))
+	reply, err := quotaScript.Run(ctx, d.Client, []string{key}, n, limit, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return QuotaResult{}, err
+	}
+
+	// PTTL is negative for a counter that doesn't exist yet, which only
+	// happens when the very first request is already over the limit
+	reset := time.Duration(reply[2]) * time.Millisecond
+	if reset < 0 {
+		reset = window
+	}
+
+	return QuotaResult{
+		Allowed:    reply[0] == 1,
+		Used:       reply[1],
+		Remaining:  max(0, limit-reply[1]),
+		ResetAfter: reset,
+	}, nil
+}
+
+type memoryBucket struct {
+	tokens float64
+	ts     time.Time
+}
+
+type memoryQuota struct {
+	used      int64
+	expiresAt time.Time
+}
+
+// MemoryLimiter is a thread-safe, in-process Limiter. Every replica keeps
+// its own limits, so a client spread across N replicas gets N times the
+// limit; use the Redis backed Database when that matters.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	quotas  map[string]*memoryQuota
+	done    chan struct{}
+	once    sync.Once
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	l := &MemoryLimiter{
+		buckets: make(map[string]*memoryBucket),
+		quotas:  make(map[string]*memoryQuota),
+		done:    make(chan struct{}),
+	}
+
+	go l.sweep(memorySweepInterval)
+
+	return l
+}
+
+func (l *MemoryLimiter) TakeToken(ctx context.Context, key string, bucket Bucket) (BucketResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: float64(bucket.Burst), ts: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(bucket.Burst), b.tokens+now.Sub(b.ts).Seconds()*bucket.Rate)
+	b.ts = now
+
+	result := BucketResult{}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / bucket.Rate)
+	}
+	result.Remaining = int64(math.Floor(b.tokens))
+	result.ResetAfter = seconds((float64(bucket.Burst) - b.tokens) / bucket.Rate)
+
+	return result, nil
+}
+
+func (l *MemoryLimiter) ConsumeQuota(ctx context.Context, key string, n int64, limit int64, window time.Duration) (QuotaResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	q, ok := l.quotas[key]
+	if !ok || !now.Before(q.expiresAt) {
+		q = &memoryQuota{expiresAt: now.Add(window)}
+		l.quotas[key] = q
+	}
+
+	result := QuotaResult{
+		ResetAfter: q.expiresAt.Sub(now),
+	}
+	if q.used+n <= limit {
+		q.used += n
+		result.Allowed = true
+	}
+	result.Used = q.used
+	result.Remaining = max(0, limit-q.used)
+
+	return result, nil
+}
+
+func (l *MemoryLimiter) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
+
+// drop finished quotas and buckets nobody has touched for an hour, by
+// which time any sane bucket has long since refilled
+func (l *MemoryLimiter) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			for key, b := range l.buckets {
+				if now.Sub(b.ts) > time.Hour {
+					delete(l.buckets, key)
+				}
+			}
+			for key, q := range l.quotas {
+				if !now.Before(q.expiresAt) {
+					delete(l.quotas, key)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog"
+)
+
+var (
+	// ErrLockNotHeld is returned when extending or releasing a lock that
+	// somebody else holds.
+	ErrLockNotHeld = errors.New("Lock is not held by this owner")
+	// ErrLockExpired is returned when extending or releasing a lock that
+	// nobody holds anymore, typically because its TTL ran out first.
+	ErrLockExpired = errors.New("Lock is not held by anyone")
+)
+
+// LockHeldError is returned when acquiring a lock somebody else holds.
+// RetryAfter is how long until it expires, if they don't extend it.
+type LockHeldError struct {
+	Name       string
+	RetryAfter time.Duration
+}
+
+func (e *LockHeldError) Error() string {
+	return fmt.Sprintf("Lock [%s] is held by another owner", e.Name)
+}
+
+// Lock is a lock shared through Redis, for mutual exclusion across pods.
+// Whoever holds it is identified by Owner, and only they can extend or
+// release it. Every time the lock changes hands it gets a new, strictly
+// larger fencing Token; pass it along with any write the lock protects,
+// so the system being written to can turn away a holder whose lock
+// expired while it was paused.
+type Lock struct {
+	db    *Database
+	Name  string
+	Owner string
+	Token int64
+}
+
+// the lock itself is a hash of owner and token; the fencing counter lives
+// next to it and never expires, so tokens keep going up even after the
+// lock has expired. Acquiring a lock you already hold extends it and
+// keeps the same token.
+var acquireLockScript = redis.NewScript(`
+local owner = redis.call('HGET', KEYS[1], 'owner')
+if owner and owner ~= ARGV[1] then
+  return {0, 0, redis.call('PTTL', KEYS[1])}
+end
+
+if owner == ARGV[1] then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+  return {1, tonumber(redis.call('HGET', KEYS[1], 'token')), 0}
+end
+
+local token = redis.call('INCR', KEYS[2])
+redis.call('HSET', KEYS[1], 'owner', ARGV[1], 'token', token)
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return {1, token, 0}
+`)
+
+// both of these answer 0 when someone else holds the lock and -1 when
+// nobody does. Otherwise release answers 1, and extend the lock's token,
+// which is never less than 1.
+var extendLockScript = redis.NewScript(`
+local owner = redis.call('HGET', KEYS[1], 'owner')
+if not owner then
+  return -1
+end
+if owner ~= ARGV[1] then
+  return 0
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return tonumber(redis.call('HGET', KEYS[1], 'token'))
+`)
+
+var releaseLockScript = redis.NewScript(`
+local owner = redis.call('HGET', KEYS[1], 'owner')
+if not owner then
+  return -1
+end
+if owner ~= ARGV[1] then
+  return 0
+end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+// NewLock returns the lock called name, as seen by owner. Nothing is
+// sent to Redis until it's acquired.
+func (d *Database) NewLock(name string, owner string) *Lock {
+	return &Lock{
+		db:    d,
+		Name:  name,
+		Owner: owner,
+	}
+}
+
+// the lock and its fencing counter share a hash tag, so in a cluster
+// they're on the same node and one script can use both
+func (l *Lock) keys() []string {
+	return []string{HashTag(l.Name) + ":lock", HashTag(l.Name) + ":fence"}
+}
+
+// Acquire takes the lock for ttl, setting Token. If someone else holds
+// it, the error is a *LockHeldError.
+func (l *Lock) Acquire(ctx context.Context, ttl time.Duration) error {
+	klog.Info(fmt.Sprintf("Acquiring lock [%s] for [%s] in the Redis cache...", l.Name, l.Owner))
+	reply, err := acquireLockScript.Run(ctx, l.db.Client, l.keys(), l.Owner, ttl.Milliseconds()).Int64Slice()
+	if err != nil {
+		return err
+	}
+
+	if reply[0] != 1 {
+		return &LockHeldError{
+			Name:       l.Name,
+			RetryAfter: time.Duration(reply[2]) * time.Millisecond,
+		}
+	}
+
+	l.Token = reply[1]
+	return nil
+}
+
+// turn what the extend and release scripts answered into an error
+func lockResult(reply int64) error {
+	switch {
+	case reply > 0:
+		return nil
+	case reply == 0:
+		return ErrLockNotHeld
+	default:
+		return ErrLockExpired
+	}
+}
+
+// Extend pushes the lock's expiry out to ttl from now, as long as we
+// still hold it, and sets Token.
+func (l *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	klog.Info(fmt.Sprintf("Extending lock [%s] for [%s] in the Redis cache...", l.Name, l.Owner))
+	reply, err := extendLockScript.Run(ctx, l.db.Client, l.keys()[:1], l.Owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if reply > 0 {
+		l.Token = reply
+	}
+	return lockResult(reply)
+}
+
+// Release gives the lock up, as long as we still hold it.
+func (l *Lock) Release(ctx context.Context) error {
+	klog.Info(fmt.Sprintf("Releasing lock [%s] for [%s] in the Redis cache...", l.Name, l.Owner))
+	reply, err := releaseLockScript.Run(ctx, l.db.Client, l.keys()[:1], l.Owner).Int64()
+	if err != nil {
+		return err
+	}
+	return lockResult(reply)
+}
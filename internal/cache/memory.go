@@ -0,0 +1,390 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// how often the background sweep drops expired entries; reads check
+// expiry themselves, so this only keeps memory from growing unbounded
+var memorySweepInterval = time.Minute
+
+// an entry holds either a plain string value or, when hash isn't nil, a
+// hash of fields; like Redis, a key is only ever one kind of thing
+type memoryEntry struct {
+	value     string
+	hash      map[string]string
+	expiresAt time.Time
+}
+
+// an entry with a zero expiresAt never expires, matching Redis' behaviour
+// for a SET without a TTL
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// MemoryStore is a thread-safe, in-process Store with TTL expiry. It's
+// meant for running the app and its tests on a laptop, not for production;
+// nothing is shared between replicas and nothing survives a restart.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]memoryEntry
+	done    chan struct{}
+	once    sync.Once
+}
+
+func NewMemoryStore() *MemoryStore {
+	m := &MemoryStore{
+		entries: make(map[string]memoryEntry),
+		done:    make(chan struct{}),
+	}
+
+	go m.sweep(memorySweepInterval)
+
+	return m
+}
+
+func (m *MemoryStore) Ping(ctx context.Context) (string, error) {
+	klog.Info("Pinging in-memory store...")
+	return "PONG", nil
+}
+
+func (m *MemoryStore) Set(ctx context.Context, key string, value string, expiration int) (string, error) {
+	klog.Info(fmt.Sprintf("Writing key [%s] with value [%s] and TTL of [%v] seconds to in-memory store...", key, value, time.Duration(expiration)*time.Second))
+
+	entry := memoryEntry{value: value}
+	if expiration > 0 {
+		entry.expiresAt = time.Now().Add(time.Duration(expiration) * time.Second)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = entry
+
+	return "OK", nil
+}
+
+func (m *MemoryStore) Get(ctx context.Context, key string) (string, error) {
+	klog.Info(fmt.Sprintf("Fetching key [%s] from the in-memory store...", key))
+
+	m.mu.RLock()
+	entry, ok := m.entries[key]
+	m.mu.RUnlock()
+
+	if !ok || entry.expired(time.Now()) {
+		return "", &NotFoundError{Key: key}
+	}
+	if entry.hash != nil {
+		return "", &WrongTypeError{Key: key}
+	}
+
+	return entry.value, nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, key string) (int64, error) {
+	klog.Info(fmt.Sprintf("Deleting key [%s] from the in-memory store...", key))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return 0, nil
+	}
+	delete(m.entries, key)
+
+	// an expired entry that hasn't been swept yet doesn't count as
+	// deleted, same as in Redis
+	if entry.expired(time.Now()) {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func (m *MemoryStore) Exists(ctx context.Context, key string) (bool, error) {
+	klog.Info(fmt.Sprintf("Checking for key [%s] in the in-memory store...", key))
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.entries[key]
+	return ok && !entry.expired(time.Now()), nil
+}
+
+func (m *MemoryStore) GetMany(ctx context.Context, keys ...string) (map[string]string, error) {
+	klog.Infof("Fetching [%d] keys from the in-memory store...", len(keys))
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	results := make(map[string]string, len(keys))
+	for _, key := range keys {
+		// MGET answers nil for keys holding hashes, so we skip them too
+		if entry, ok := m.entries[key]; ok && !entry.expired(now) && entry.hash == nil {
+			results[key] = entry.value
+		}
+	}
+	return results, nil
+}
+
+func (m *MemoryStore) DeleteMany(ctx context.Context, keys ...string) (int64, error) {
+	klog.Infof("Deleting [%d] keys from the in-memory store...", len(keys))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var deleted int64
+	for _, key := range keys {
+		entry, ok := m.entries[key]
+		if !ok {
+			continue
+		}
+		delete(m.entries, key)
+		if !entry.expired(now) {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// the live entry at key to add delta to, or a fresh one with the given
+// TTL; like the Redis scripts, only a new counter gets the TTL
+func (m *MemoryStore) counter(key string, expiration int, now time.Time) (memoryEntry, error) {
+	entry, ok := m.entries[key]
+	if ok && !entry.expired(now) {
+		if entry.hash != nil {
+			return entry, &WrongTypeError{Key: key}
+		}
+		return entry, nil
+	}
+
+	entry = memoryEntry{value: "0"}
+	if expiration > 0 {
+		entry.expiresAt = now.Add(time.Duration(expiration) * time.Second)
+	}
+	return entry, nil
+}
+
+func (m *MemoryStore) IncrBy(ctx context.Context, key string, delta int64, expiration int) (int64, error) {
+	klog.Info(fmt.Sprintf("Incrementing key [%s] by [%d] in the in-memory store...", key, delta))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, err := m.counter(key, expiration, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(entry.value, 10, 64)
+	if err != nil {
+		return 0, &NotANumberError{Key: key}
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, &OverflowError{Key: key}
+	}
+
+	n += delta
+	entry.value = strconv.FormatInt(n, 10)
+	m.entries[key] = entry
+
+	return n, nil
+}
+
+func (m *MemoryStore) IncrByFloat(ctx context.Context, key string, delta float64, expiration int) (float64, error) {
+	klog.Info(fmt.Sprintf("Incrementing key [%s] by [%v] in the in-memory store...", key, delta))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, err := m.counter(key, expiration, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(entry.value, 64)
+	if err != nil {
+		return 0, &NotANumberError{Key: key}
+	}
+
+	f += delta
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, &OverflowError{Key: key}
+	}
+	entry.value = strconv.FormatFloat(f, 'f', -1, 64)
+	m.entries[key] = entry
+
+	return f, nil
+}
+
+// the live hash at key, if there is one; a key holding a plain string
+// value is a WrongTypeError, the same as Redis' WRONGTYPE
+func (m *MemoryStore) hash(key string, now time.Time) (memoryEntry, bool, error) {
+	entry, ok := m.entries[key]
+	if !ok || entry.expired(now) {
+		return memoryEntry{}, false, nil
+	}
+	if entry.hash == nil {
+		return memoryEntry{}, false, &WrongTypeError{Key: key}
+	}
+	return entry, true, nil
+}
+
+// a copy of fields, so callers can't change a hash without holding the lock
+func copyFields(fields map[string]string) map[string]string {
+	result := make(map[string]string, len(fields))
+	for field, value := range fields {
+		result[field] = value
+	}
+	return result
+}
+
+func (m *MemoryStore) HGet(ctx context.Context, key string, field string) (string, error) {
+	klog.Info(fmt.Sprintf("Fetching field [%s] of key [%s] from the in-memory store...", field, key))
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok, err := m.hash(key, time.Now())
+	if err != nil {
+		return "", err
+	}
+	value, found := entry.hash[field]
+	if !ok || !found {
+		return "", &FieldNotFoundError{Key: key, Field: field}
+	}
+	return value, nil
+}
+
+func (m *MemoryStore) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	klog.Info(fmt.Sprintf("Fetching hash [%s] from the in-memory store...", key))
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok, err := m.hash(key, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &NotFoundError{Key: key}
+	}
+	return copyFields(entry.hash), nil
+}
+
+func (m *MemoryStore) ReplaceHash(ctx context.Context, key string, fields map[string]string, expiration int) error {
+	klog.Info(fmt.Sprintf("Writing hash [%s] with [%d] fields and TTL of [%v] seconds to in-memory store...", key, len(fields), time.Duration(expiration)*time.Second))
+
+	entry := memoryEntry{hash: copyFields(fields)}
+	if expiration > 0 {
+		entry.expiresAt = time.Now().Add(time.Duration(expiration) * time.Second)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = entry
+
+	return nil
+}
+
+func (m *MemoryStore) UpdateHash(ctx context.Context, key string, fields map[string]string, expiration int, keepTTL bool) (map[string]string, error) {
+	klog.Info(fmt.Sprintf("Updating [%d] fields of hash [%s] in the in-memory store...", len(fields), key))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	entry, existed, err := m.hash(key, now)
+	if err != nil {
+		return nil, err
+	}
+	if !existed {
+		entry = memoryEntry{hash: make(map[string]string, len(fields))}
+	}
+	for field, value := range fields {
+		entry.hash[field] = value
+	}
+	if !existed || !keepTTL {
+		entry.expiresAt = time.Time{}
+		if expiration > 0 {
+			entry.expiresAt = now.Add(time.Duration(expiration) * time.Second)
+		}
+	}
+	m.entries[key] = entry
+
+	return copyFields(entry.hash), nil
+}
+
+func (m *MemoryStore) HDel(ctx context.Context, key string, fields ...string) (int64, error) {
+	klog.Info(fmt.Sprintf("Deleting fields %v of key [%s] from the in-memory store...", fields, key))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok, err := m.hash(key, time.Now())
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	var deleted int64
+	for _, field := range fields {
+		if _, found := entry.hash[field]; found {
+			delete(entry.hash, field)
+			deleted++
+		}
+	}
+	// Redis doesn't keep empty hashes around, so neither do we
+	if len(entry.hash) == 0 {
+		delete(m.entries, key)
+	}
+	return deleted, nil
+}
+
+func (m *MemoryStore) DeleteHash(ctx context.Context, key string) (int64, error) {
+	klog.Info(fmt.Sprintf("Deleting hash [%s] from the in-memory store...", key))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok, err := m.hash(key, time.Now())
+	if err != nil || !ok {
+		return 0, err
+	}
+	delete(m.entries, key)
+	return 1, nil
+}
+
+func (m *MemoryStore) Close() error {
+	klog.Info("Closing in-memory store...")
+	m.once.Do(func() {
+		close(m.done)
+	})
+	return nil
+}
+
+// drop expired entries every interval until the store is closed
+func (m *MemoryStore) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			for key, entry := range m.entries {
+				if entry.expired(now) {
+					delete(m.entries, key)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	commandDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "redistester",
+			Subsystem: "redis",
+			Name:      "command_duration_seconds",
+			Help:      "Latency of Redis commands, by command name.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		},
+		[]string{"command"},
+	)
+
+	commandErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "redistester",
+			Subsystem: "redis",
+			Name:      "command_errors_total",
+			Help:      "Redis commands that returned an error, by command name. Missing keys are not errors.",
+		},
+		[]string{"command"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(commandDuration, commandErrors)
+}
+
+// a go-redis hook that times every command the client sends. Hooking the
+// client rather than wrapping each Database method means anything we add
+// to Database later gets measured without having to remember to.
+type metricsHook struct{}
+
+func (metricsHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (metricsHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		observeCommand(cmd.Name(), start, err)
+		return err
+	}
+}
+
+func (metricsHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		observeCommand("pipeline", start, err)
+		return err
+	}
+}
+
+// record how long a command took and whether it failed; redis.Nil just
+// means the key wasn't there, so it doesn't count as an error
+func observeCommand(command string, start time.Time, err error) {
+	commandDuration.WithLabelValues(command).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, redis.Nil) {
+		commandErrors.WithLabelValues(command).Inc()
+	}
+}
+
+// anything that can report go-redis connection pool stats; every kind of
+// go-redis client can
+type poolStatser interface {
+	PoolStats() *redis.PoolStats
+}
+
+// a prometheus.Collector that reads the go-redis connection pool stats
+// each time we're scraped, rather than us polling them in the background
+type poolStatsCollector struct {
+	client poolStatser
+
+	hits       *prometheus.Desc
+	misses     *prometheus.Desc
+	timeouts   *prometheus.Desc
+	totalConns *prometheus.Desc
+	idleConns  *prometheus.Desc
+	staleConns *prometheus.Desc
+}
+
+// NewPoolStatsCollector returns a collector for the connection pool
+// behind d, ready to be registered with Prometheus
+func NewPoolStatsCollector(d *Database) prometheus.Collector {
+	desc := func(name string, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("redistester", "redis_pool", name), help, nil, nil)
+	}
+
+	return &poolStatsCollector{
+		client:     d.Client,
+		hits:       desc("hits_total", "Times a free connection was found in the pool."),
+		misses:     desc("misses_total", "Times a free connection was not found in the pool."),
+		timeouts:   desc("timeouts_total", "Times a wait for a connection timed out."),
+		totalConns: desc("total_conns", "Connections currently in the pool."),
+		idleConns:  desc("idle_conns", "Idle connections currently in the pool."),
+		staleConns: desc("stale_conns_total", "Stale connections removed from the pool."),
+	}
+}
+
+func (c *poolStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.timeouts
+	ch <- c.totalConns
+	ch <- c.idleConns
+	ch <- c.staleConns
+}
+
+func (c *poolStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.client.PoolStats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(c.staleConns, prometheus.CounterValue, float64(stats.StaleConns))
+}
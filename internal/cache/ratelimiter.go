@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog"
+)
+
+// the algorithms a RateLimiter can use
+const (
+	// an exact log of every request in the last period, kept in a sorted
+	// set; precise, but it costs memory per request allowed
+	AlgorithmSlidingWindow = "sliding-window"
+	// the generic cell rate algorithm, which spaces requests out evenly
+	// and allows a burst of up to the limit; it only stores one timestamp
+	AlgorithmGCRA = "gcra"
+)
+
+// RateLimit allows Limit requests every Period.
+type RateLimit struct {
+	Limit  int64
+	Period time.Duration
+}
+
+// RateLimitResult is the answer to "may I?". Remaining is how many more
+// requests would be allowed right now, ResetAfter how long until the
+// limit is back to full, and RetryAfter, when a request was refused, how
+// long until it would be allowed.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int64
+	Remaining  int64
+	ResetAfter time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimiter answers whether a caller may do something now, against
+// limits shared by everyone using the same Redis. Each check is a single
+// Lua script, so concurrent callers can never both take the last slot.
+type RateLimiter struct {
+	db        *Database
+	algorithm string
+	script    *redis.Script
+}
+
+// the current Redis time in milliseconds, as a float
+const luaNowMs = `
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + tonumber(t[2]) / 1000
+`
+
+// one entry per request, scored by when it was made and carrying its
+// cost after the last colon, with the total cost of the entries in the
+// window kept in a second key. A request of any cost is a single ZADD, so
+// the work per check doesn't grow with the cost or the limit; entries
+// leaving the window are removed once each, when the first check after
+// they expire takes their cost off the total. Members only have to be
+// unique, so we use the time and how many were in the set, which can't
+// repeat as scripts run one at a time.
+var slidingWindowScript = redis.NewScript(luaNowMs + `
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+
+local function weight(member)
+  return tonumber(string.match(member, ':(%d+)$'))
+end
+
+local used = 0
+if redis.call('EXISTS', KEYS[1]) == 1 then
+  used = tonumber(redis.call('GET', KEYS[2]) or '0')
+  local expired = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now - period)
+  for _, member in ipairs(expired) do
+    used = used - weight(member)
+  end
+  if #expired > 0 then
+    redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - period)
+  end
+  used = math.max(0, used)
+end
+
+local allowed = 0
+local retry = 0
+if used + cost <= limit then
+  local count = redis.call('ZCARD', KEYS[1])
+  redis.call('ZADD', KEYS[1], now, tostring(now) .. '-' .. tostring(count) .. ':' .. tostring(cost))
+  used = used + cost
+  allowed = 1
+  redis.call('PEXPIRE', KEYS[1], math.ceil(period))
+  redis.call('SET', KEYS[2], used, 'PX', math.ceil(period))
+else
+  -- wait until enough of the oldest entries have left the window. There
+  -- are never more entries than the limit, which the server caps.
+  local needed = used + cost - limit
+  local entries = redis.call('ZRANGE', KEYS[1], 0, -1, 'WITHSCORES')
+  retry = period
+  for i = 1, #entries, 2 do
+    needed = needed - weight(entries[i])
+    if needed <= 0 then
+      retry = tonumber(entries[i + 1]) + period - now
+      break
+    end
+  end
+end
+
+-- the window is empty again once the newest entry has left it
+local reset = 0
+local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+if newest[2] then
+  reset = tonumber(newest[2]) + period - now
+end
+
+return {allowed, math.max(0, limit - used), tostring(reset), tostring(retry)}
+`)
+
+// the theoretical arrival time (TAT) is when the limiter would be empty
+// again; each request pushes it on by one emission interval, and a
+// request is refused if that would put it more than the whole period
+// ahead of now
+var gcraScript = redis.NewScript(luaNowMs + `
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+
+local interval = period / limit
+local tat = math.max(tonumber(redis.call('GET', KEYS[1]) or '0'), now)
+local newTat = tat + cost * interval
+local allowAt = newTat - period
+
+local allowed = 0
+local retry = 0
+if now >= allowAt then
+  allowed = 1
+  tat = newTat
+  redis.call('SET', KEYS[1], tostring(tat), 'PX', math.ceil(tat - now))
+else
+  retry = allowAt - now
+end
+
+-- nudge up a little before rounding down, or float error turns a
+-- remaining of 2 into 1.9999 and then 1
+local remaining = math.floor((now - (tat - period)) / interval + 1e-6)
+return {allowed, math.max(0, remaining), tostring(tat - now), tostring(retry)}
+`)
+
+// NewRateLimiter creates a RateLimiter using the given algorithm.
+func NewRateLimiter(d *Database, algorithm string) (*RateLimiter, error) {
+	rl := &RateLimiter{
+		db:        d,
+		algorithm: algorithm,
+	}
+
+	switch algorithm {
+	case AlgorithmSlidingWindow:
+		rl.script = slidingWindowScript
+	case AlgorithmGCRA:
+		rl.script = gcraScript
+	default:
+		return nil, fmt.Errorf("Invalid rate limit algorithm [%s], supported algorithms are [%s %s]", algorithm, AlgorithmSlidingWindow, AlgorithmGCRA)
+	}
+
+	return rl, nil
+}
+
+// milliseconds, as a float, to a time.Duration
+func floatMilliseconds(s string) time.Duration {
+	ms, _ := strconv.ParseFloat(s, 64)
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// Allow reports whether one more request under key fits within limit.
+func (rl *RateLimiter) Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	return rl.AllowN(ctx, key, limit, 1)
+}
+
+// AllowN reports whether n more requests under key fit within limit,
+// counting them if they do. Either all n are allowed or none are.
+func (rl *RateLimiter) AllowN(ctx context.Context, key string, limit RateLimit, n int64) (RateLimitResult, error) {
+	klog.Info(fmt.Sprintf("Checking [%s] rate limit [%s] in the Redis cache...", rl.algorithm, key))
+	if limit.Limit < 1 || limit.Period < time.Millisecond {
+		return RateLimitResult{}, fmt.Errorf("Invalid rate limit of %d every %v", limit.Limit, limit.Period)
+	}
+
+	if n > limit.Limit {
+		return RateLimitResult{}, fmt.Errorf("A cost of %d can never fit within a limit of %d", n, limit.Limit)
+	}
+
+	// the sliding window keeps its running total next to the entries,
+	// under the same hash tag so a cluster keeps them on one node
+	keys := []string{key}
+	if rl.algorithm == AlgorithmSlidingWindow {
+		keys = []string{HashTag(key), HashTag(key) + ":total"}
+	}
+
+	reply, err := rl.script.Run(ctx, rl.db.Client, keys, limit.Limit, limit.Period.Milliseconds(), n).Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	allowed, _ := reply[0].(int64)
+	remaining, _ := reply[1].(int64)
+
+	return RateLimitResult{
+		Allowed:    allowed == 1,
+		Limit:      limit.Limit,
+		Remaining:  remaining,
+		ResetAfter: floatMilliseconds(reply[2].(string)),
+		RetryAfter: floatMilliseconds(reply[3].(string)),
+	}, nil
+}
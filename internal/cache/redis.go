@@ -4,49 +4,173 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"k8s.io/klog"
 )
 
+// the ways we know how to connect to Redis
+const (
+	// a single Redis server at a fixed address
+	ModeStandalone = "standalone"
+	// a master found through Sentinel, followed across failovers
+	ModeSentinel = "sentinel"
+	// a Redis Cluster, discovered from a list of seed nodes
+	ModeCluster = "cluster"
+)
+
 type Database struct {
-	Client  *redis.Client
-	Context *context.Context
+	Client redis.UniversalClient
 }
 
 var (
-	ErrNil         = errors.New("No matching record found in redis database")
-	defaultContext = context.TODO()
+	ErrNil = errors.New("No matching record found in redis database")
 )
 
-func NewRedisDatabase(options *redis.Options, ctx *context.Context) (*Database, error) {
-	if ctx == nil {
-		ctx = &defaultContext
+// NotFoundError is returned when a key doesn't exist in the cache. It
+// matches ErrNil with errors.Is, so callers that only care whether a
+// key was missing don't need to know about the type at all.
+type NotFoundError struct {
+	Key string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("No matching record found for key [%s]", e.Key)
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNil
+}
+
+// build the go-redis client for a connection mode. For Sentinel, Addrs
+// are the sentinels and MasterName picks which master they should find
+// for us; for a cluster they're seed nodes; for standalone the first of
+// Addrs is the server itself.
+func newClient(mode string, options *redis.UniversalOptions) (redis.UniversalClient, error) {
+	switch mode {
+	case "", ModeStandalone:
+		return redis.NewClient(options.Simple()), nil
+	case ModeSentinel:
+		if options.MasterName == "" {
+			return nil, errors.New("Sentinel mode requires a master name")
+		}
+		if len(options.Addrs) == 0 {
+			return nil, errors.New("Sentinel mode requires at least one sentinel address")
+		}
+		client := redis.NewFailoverClient(options.Failover())
+		client.AddHook(newFailoverHook(options.MasterName))
+		return client, nil
+	case ModeCluster:
+		// the cluster client finds the rest of the nodes from the seeds
+		// and follows MOVED and ASK redirects for us as slots migrate
+		if len(options.Addrs) == 0 {
+			return nil, errors.New("Cluster mode requires at least one seed node address")
+		}
+		if options.DB != 0 {
+			return nil, errors.New("Redis Cluster only supports database 0")
+		}
+		return redis.NewClusterClient(options.Cluster()), nil
+	default:
+		return nil, fmt.Errorf("Invalid Redis mode [%s], supported modes are [%s %s %s]", mode, ModeStandalone, ModeSentinel, ModeCluster)
 	}
-	client := redis.NewClient(options)
+}
 
-	if err := client.Ping(defaultContext).Err(); err != nil {
+// NewRedisDatabase builds a Database for the given connection mode. It
+// doesn't wait for Redis to answer - go-redis connects lazily - so it only
+// fails on bad options; use WaitForStore to find out when Redis is up.
+func NewRedisDatabase(mode string, options *redis.UniversalOptions) (*Database, error) {
+	client, err := newClient(mode, options)
+	if err != nil {
 		return nil, err
 	}
+	client.AddHook(metricsHook{})
 
 	return &Database{
-		Client:  client,
-		Context: ctx,
+		Client: client,
 	}, nil
 }
 
-func (d *Database) Ping() (string, error) {
+// turn on a tracing span for every command sent to Redis; when hashKeys
+// is set, spans carry a hash of the key rather than the key itself
+func (d *Database) EnableTracing(hashKeys bool) {
+	d.Client.AddHook(tracingHook{hashKeys: hashKeys})
+}
+
+func (d *Database) Ping(ctx context.Context) (string, error) {
 	klog.Info("Pinging database...")
-	return d.Client.Ping(*d.Context).Result()
+	return d.Client.Ping(ctx).Result()
 }
 
-func (d *Database) Set(key string, value string, expiration int) (string, error) {
+func (d *Database) Set(ctx context.Context, key string, value string, expiration int) (string, error) {
 	klog.Info(fmt.Sprintf("Writing key [%s] with value [%s] and TTL of [%v] seconds to Redis cache...", key, value, time.Duration(expiration)*time.Second))
-	return d.Client.Set(*d.Context, key, value, time.Duration(expiration)*time.Second).Result()
+	return d.Client.Set(ctx, key, value, time.Duration(expiration)*time.Second).Result()
 }
 
-func (d *Database) Get(key string) (string, error) {
+func (d *Database) Get(ctx context.Context, key string) (string, error) {
 	klog.Info(fmt.Sprintf("Fetching key [%s] from the Redis cache...", key))
-	return d.Client.Get(*d.Context, key).Result()
+	result, err := d.Client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", &NotFoundError{Key: key}
+	}
+	return result, hashError(key, err)
+}
+
+func (d *Database) Delete(ctx context.Context, key string) (int64, error) {
+	klog.Info(fmt.Sprintf("Deleting key [%s] from the Redis cache...", key))
+	return d.Client.Del(ctx, key).Result()
+}
+
+func (d *Database) Exists(ctx context.Context, key string) (bool, error) {
+	klog.Info(fmt.Sprintf("Checking for key [%s] in the Redis cache...", key))
+	n, err := d.Client.Exists(ctx, key).Result()
+	return n > 0, err
+}
+
+// Info runs INFO for each of the given sections and parses the replies
+// into a map of section name to fields, e.g. info["server"]["redis_version"].
+// We ask for one section at a time because Redis only takes several at
+// once from 7.0 on. In cluster mode the reply comes from whichever node
+// go-redis picks.
+func (d *Database) Info(ctx context.Context, sections ...string) (map[string]map[string]string, error) {
+	info := map[string]map[string]string{}
+	for _, s := range sections {
+		klog.Info(fmt.Sprintf("Fetching INFO [%s] from the Redis cache...", s))
+		reply, err := d.Client.Info(ctx, s).Result()
+		if err != nil {
+			return nil, err
+		}
+		parseInfo(reply, info)
+	}
+	return info, nil
+}
+
+// parse an INFO reply into info, one map per section
+func parseInfo(reply string, info map[string]map[string]string) {
+	var section map[string]string
+	for _, line := range strings.Split(reply, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// sections start with a header like "# Server"
+		if strings.HasPrefix(line, "#") {
+			section = map[string]string{}
+			info[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(line, "#")))] = section
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || section == nil {
+			continue
+		}
+		section[name] = value
+	}
+}
+
+func (d *Database) Close() error {
+	klog.Info("Closing connections to the Redis cache...")
+	return d.Client.Close()
 }
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog"
+)
+
+var masterChanges = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "redistester",
+		Subsystem: "redis",
+		Name:      "master_changes_total",
+		Help:      "Times the Sentinel-managed Redis master moved to a new address, by master name.",
+	},
+	[]string{"master"},
+)
+
+func init() {
+	prometheus.MustRegister(masterChanges)
+}
+
+// a go-redis hook that watches where a failover client's connections
+// actually end up. The failover client asks Sentinel for the master's
+// address on every dial, so when a new connection lands somewhere other
+// than the last one did, the master has moved.
+type failoverHook struct {
+	masterName string
+
+	mu     sync.Mutex
+	master string
+}
+
+func newFailoverHook(masterName string) *failoverHook {
+	return &failoverHook{masterName: masterName}
+}
+
+func (h *failoverHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err == nil {
+			// the address we're handed is a placeholder; the failover
+			// client resolves the real one inside the dialer, so we have
+			// to look at where the connection really went
+			h.observe(conn.RemoteAddr().String())
+		}
+		return conn, err
+	}
+}
+
+func (h *failoverHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h *failoverHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+// record the address of a new connection to the master, and log and
+// count it if it's not where the master was before
+func (h *failoverHook) observe(addr string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.master == addr {
+		return
+	}
+
+	if h.master == "" {
+		klog.Infof("Sentinel reports master [%s] at [%s]", h.masterName, addr)
+	} else {
+		klog.Warningf("Sentinel master [%s] changed from [%s] to [%s]", h.masterName, h.master, addr)
+		masterChanges.WithLabelValues(h.masterName).Inc()
+	}
+	h.master = addr
+}
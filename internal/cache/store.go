@@ -0,0 +1,33 @@
+package cache
+
+import "context"
+
+// Store is the set of cache operations the server relies on. The Redis
+// backed Database is the real implementation; MemoryStore keeps
+// everything in-process so the app can run without a Redis server.
+// Every operation takes the context of the request it's serving, so
+// traces and cancellation follow the call all the way down.
+type Store interface {
+	Ping(ctx context.Context) (string, error)
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value string, expiration int) (string, error)
+	Delete(ctx context.Context, key string) (int64, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	GetMany(ctx context.Context, keys ...string) (map[string]string, error)
+	DeleteMany(ctx context.Context, keys ...string) (int64, error)
+	IncrBy(ctx context.Context, key string, delta int64, expiration int) (int64, error)
+	IncrByFloat(ctx context.Context, key string, delta float64, expiration int) (float64, error)
+	HGet(ctx context.Context, key string, field string) (string, error)
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	ReplaceHash(ctx context.Context, key string, fields map[string]string, expiration int) error
+	UpdateHash(ctx context.Context, key string, fields map[string]string, expiration int, keepTTL bool) (map[string]string, error)
+	HDel(ctx context.Context, key string, fields ...string) (int64, error)
+	DeleteHash(ctx context.Context, key string) (int64, error)
+	Close() error
+}
+
+// make sure both of our implementations keep satisfying the interface
+var (
+	_ Store = (*Database)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
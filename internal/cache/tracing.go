@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the instrumentation name our spans are reported under
+const tracerName = "github.com/blomquistr/go-redis-example/v2/internal/cache"
+
+// a go-redis hook that starts a child span for every command, under
+// whatever span is already in the context the command was sent with.
+// Like metricsHook it sits on the client, so new Database methods get
+// traced for free.
+type tracingHook struct {
+	hashKeys bool
+}
+
+func (h tracingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h tracingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := otel.Tracer(tracerName).Start(ctx, strings.ToUpper(cmd.Name()),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(h.commandAttributes(cmd)...),
+		)
+		defer span.End()
+
+		err := next(ctx, cmd)
+		recordError(span, err)
+		return err
+	}
+}
+
+func (h tracingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := otel.Tracer(tracerName).Start(ctx, "PIPELINE",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "redis"),
+				attribute.Int("db.redis.pipeline_length", len(cmds)),
+			),
+		)
+		defer span.End()
+
+		err := next(ctx, cmds)
+		recordError(span, err)
+		return err
+	}
+}
+
+// describe a command for its span. We never record values, only the
+// command name and the key it works on - and even the key can be swapped
+// for a hash when keys themselves are sensitive.
+func (h tracingHook) commandAttributes(cmd redis.Cmder) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "redis"),
+		attribute.String("db.operation", cmd.Name()),
+	}
+
+	key, ok := commandKey(cmd)
+	if !ok {
+		return attrs
+	}
+	if h.hashKeys {
+		return append(attrs, attribute.String("db.redis.key_hash", hashKey(key)))
+	}
+	return append(attrs, attribute.String("db.redis.key", key))
+}
+
+// the key a command works on. That's usually its first argument, but
+// script calls go EVAL script numkeys key..., and every script-backed
+// operation (counters, hashes, locks, the rate limiters) goes through
+// them, so there the key is the first of KEYS, if the script has any.
+func commandKey(cmd redis.Cmder) (string, bool) {
+	args := cmd.Args()
+
+	switch cmd.Name() {
+	case "eval", "eval_ro", "evalsha", "evalsha_ro", "fcall", "fcall_ro":
+		if len(args) < 4 {
+			return "", false
+		}
+		numKeys, err := strconv.Atoi(fmt.Sprint(args[2]))
+		if err != nil || numKeys < 1 {
+			return "", false
+		}
+		return fmt.Sprint(args[3]), true
+	}
+
+	if len(args) < 2 {
+		return "", false
+	}
+	return fmt.Sprint(args[1]), true
+}
+
+// a short, stable hash of a key; enough to tell keys apart in a trace
+// without giving away what's in them
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// mark a span as failed, unless the error is redis.Nil, which only means
+// the key wasn't there
+func recordError(span trace.Span, err error) {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// the scopes an API key can be granted
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+	scopeAdmin = "admin"
+)
+
+// the header callers can send an API key in, as an alternative to
+// Authorization: Bearer
+const apiKeyHeader = "X-API-Key"
+
+// a struct representing one API key. We never store the key itself,
+// only the hex SHA-256 of it, so a leaked config file or environment
+// doesn't hand out working keys. Make one with
+//
+//	printf %s "$KEY" | sha256sum
+type APIKey struct {
+	Name   string   `json:"name"`
+	Hash   string   `json:"hash"`
+	Scopes []string `json:"scopes"`
+}
+
+// a struct representing the API keys file
+type APIKeysFile struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// a struct holding the API keys we currently accept, indexed by hash.
+// Keys from the environment are fixed for the life of the process; keys
+// from the file are picked up again whenever the file changes, the same
+// way certReloader handles certificates.
+type apiKeyStore struct {
+	file    string
+	envKeys []APIKey
+
+	mu       sync.RWMutex
+	keys     map[string]*APIKey
+	fileInfo os.FileInfo
+}
+
+// the keys we check requests against; nil means API key authentication
+// isn't configured and everything stays open
+var apiKeys *apiKeyStore
+
+// parse an API key from the environment, written as
+// name:sha256-hash:scope|scope, e.g. ci:9f86...0f08:read|write
+func parseAPIKey(s string) (APIKey, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return APIKey{}, fmt.Errorf("Invalid API key [%s], expected name:sha256-hash:scope|scope", parts[0])
+	}
+	return APIKey{
+		Name:   parts[0],
+		Hash:   parts[1],
+		Scopes: strings.Split(parts[2], "|"),
+	}, nil
+}
+
+// check a key is one we can use, so a typo in a scope fails loudly
+// instead of quietly locking someone out
+func validateAPIKey(key APIKey) error {
+	hash, err := hex.DecodeString(key.Hash)
+	if err != nil || len(hash) != sha256.Size {
+		return fmt.Errorf("API key [%s] must have a hex SHA-256 hash", key.Name)
+	}
+	for _, s := range key.Scopes {
+		switch s {
+		case scopeRead, scopeWrite, scopeAdmin:
+		default:
+			return fmt.Errorf("API key [%s] has invalid scope [%s], supported scopes are [read write admin]", key.Name, s)
+		}
+	}
+	return nil
+}
+
+// create the API key store from the configuration, or return nil if no
+// keys are configured at all
+func newAPIKeyStore(file string, env []string) (*apiKeyStore, error) {
+	if file == "" && len(env) == 0 {
+		return nil, nil
+	}
+
+	ks := &apiKeyStore{
+		file: file,
+	}
+	for _, s := range env {
+		key, err := parseAPIKey(s)
+		if err != nil {
+			return nil, err
+		}
+		ks.envKeys = append(ks.envKeys, key)
+	}
+
+	if err := ks.reload(); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// load the keys file, if there is one, and swap in the new set of keys
+func (ks *apiKeyStore) reload() error {
+	keys := append([]APIKey{}, ks.envKeys...)
+
+	var info os.FileInfo
+	if ks.file != "" {
+		var err error
+		info, err = os.Stat(ks.file)
+		if err != nil {
+			return err
+		}
+
+		contents, err := os.ReadFile(ks.file)
+		if err != nil {
+			return err
+		}
+
+		var f APIKeysFile
+		if err := json.Unmarshal(contents, &f); err != nil {
+			return fmt.Errorf("Error parsing API keys file [%s]: %w", ks.file, err)
+		}
+		keys = append(keys, f.Keys...)
+	}
+
+	byHash := map[string]*APIKey{}
+	for i := range keys {
+		if err := validateAPIKey(keys[i]); err != nil {
+			return err
+		}
+		byHash[strings.ToLower(keys[i].Hash)] = &keys[i]
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = byHash
+	ks.fileInfo = info
+
+	klog.Infof("Loaded %d API keys", len(byHash))
+	return nil
+}
+
+// report whether the keys file looks different from the one we last loaded
+func (ks *apiKeyStore) changed() bool {
+	if ks.file == "" {
+		return false
+	}
+
+	info, err := os.Stat(ks.file)
+	if err != nil {
+		return false
+	}
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	return !sameFile(ks.fileInfo, info)
+}
+
+// poll the keys file every interval and reload it when it changes. A
+// failed reload keeps the keys we had, rather than locking everyone out
+// over a half-written file.
+func (ks *apiKeyStore) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !ks.changed() {
+			continue
+		}
+
+		klog.Info("API keys file changed on disk, reloading...")
+		if err := ks.reload(); err != nil {
+			klog.Errorf("Error reloading API keys, keeping the previous ones: %s", err.Error())
+		}
+	}
+}
+
+// look up the key a caller sent us; we hash it first, so how long the
+// lookup takes tells the caller nothing about the keys we hold
+func (ks *apiKeyStore) lookup(key string) *APIKey {
+	sum := sha256.Sum256([]byte(key))
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.keys[hex.EncodeToString(sum[:])]
+}
+
+// a function picking the scope a request needs
+type scopeFunc func(r *http.Request) string
+
+// every request needs the same scope
+func scope(s string) scopeFunc {
+	return func(r *http.Request) string {
+		return s
+	}
+}
+
+// reading needs read, anything that changes something needs write
+func methodScope(r *http.Request) string {
+	switch r.Method {
+	case "GET", "HEAD":
+		return scopeRead
+	default:
+		return scopeWrite
+	}
+}
+
+// work out who the caller is from the credentials on the request: an
+// X-API-Key header, or a bearer token that's either a JWT from our SSO
+// or an API key. Returns nil if there's nothing we can verify.
+func authenticate(r *http.Request) *identity {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return apiKeyIdentity(key)
+	}
+
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || bearer == "" {
+		return nil
+	}
+
+	if tokens != nil && looksLikeJWT(bearer) {
+		id, err := tokens.validate(r.Context(), bearer)
+		if err != nil {
+			klog.Warningf("Rejected bearer token for %s %s: %s", r.Method, r.URL.Path, err.Error())
+			return nil
+		}
+		return id
+	}
+
+	return apiKeyIdentity(bearer)
+}
+
+// the identity behind an API key, or nil if we don't know the key
+func apiKeyIdentity(raw string) *identity {
+	if apiKeys == nil {
+		return nil
+	}
+	key := apiKeys.lookup(raw)
+	if key == nil {
+		return nil
+	}
+	return &identity{
+		Subject: "api-key:" + key.Name,
+		Scopes:  key.Scopes,
+	}
+}
+
+// a middleware that makes the caller present an API key or a JWT with
+// the scope the request needs, answering 401 without valid credentials
+// and 403 without the scope. When neither is configured it lets
+// everything through.
+func requireScope(scopeFor scopeFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if apiKeys == nil && tokens == nil {
+			next(w, r)
+			return
+		}
+
+		id := authenticate(r)
+		if id == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="redistester"`)
+			writeError(w, r, http.StatusUnauthorized, "A valid API key or bearer token is required")
+			return
+		}
+
+		// a verified client certificate still tells us who's calling,
+		// so keep its details and add what the credentials say on top
+		if cert := identityFromContext(r.Context()); cert.verified() {
+			id.SANs = append([]string{cert.Subject}, id.SANs...)
+		}
+		r = r.WithContext(context.WithValue(r.Context(), identityKey, id))
+
+		needed := scopeFor(r)
+		if !id.hasScope(needed) {
+			klog.Warningf("Caller [%s] lacks the [%s] scope for %s %s", id, needed, r.Method, r.URL.Path)
+			writeError(w, r, http.StatusForbidden, fmt.Sprintf("This request needs the [%s] scope", needed))
+			return
+		}
+
+		next(w, r)
+	}
+}
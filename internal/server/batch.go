@@ -0,0 +1,139 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"k8s.io/klog"
+)
+
+// the batch endpoints, for reading or deleting many keys in one request.
+// On a Redis Cluster the keys are split up by slot behind the scenes, so
+// callers don't need to hash tag keys that have nothing to do with each
+// other just to fetch them together.
+const (
+	batchGetPath    = "/v1/batch/get"
+	batchDeletePath = "/v1/batch/delete"
+)
+
+// the most keys one batch request may name
+const maxBatchKeys = 1000
+
+// a struct representing the body of a POST to either batch endpoint
+type BatchRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// a struct representing the answer to a batch get; keys that don't exist
+// are listed under missing rather than failing the whole request
+type BatchGetResult struct {
+	Values  map[string]string `json:"values"`
+	Missing []string          `json:"missing"`
+}
+
+// a struct representing the answer to a batch delete
+type BatchDeleteResult struct {
+	Deleted int64 `json:"deleted"`
+}
+
+// decode a BatchRequest and check the caller may perform op on every key
+// in it; if they can't touch one of them, the whole batch is refused
+func decodeBatchRequest(w http.ResponseWriter, r *http.Request, op string) ([]string, bool) {
+	methods := []string{"POST"}
+	err := checkSupportedMethod(methods, r.Method)
+	if err != nil {
+		writeMethodNotAllowed(w, r, methods, err)
+		return nil, false
+	}
+
+	var m BatchRequest
+	err = decodeJSONBody(w, r, &m)
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return nil, false
+	}
+
+	switch {
+	case len(m.Keys) == 0:
+		writeDecodeError(w, r, &malformedRequest{status: http.StatusBadRequest, msg: "Request body must include at least one key", field: "keys"})
+		return nil, false
+	case len(m.Keys) > maxBatchKeys:
+		writeDecodeError(w, r, &malformedRequest{status: http.StatusBadRequest, msg: fmt.Sprintf("A batch may include at most %d keys", maxBatchKeys), field: "keys"})
+		return nil, false
+	}
+
+	caller := identityFromContext(r.Context())
+	klog.Infof("Caller [%s] is sending a batch %s of [%d] keys", caller, op, len(m.Keys))
+
+	for _, key := range m.Keys {
+		if key == "" {
+			writeDecodeError(w, r, &malformedRequest{status: http.StatusBadRequest, msg: "Keys must not be empty", field: "keys"})
+			return nil, false
+		}
+		if !authorizeKey(w, r, op, key) {
+			return nil, false
+		}
+	}
+
+	return m.Keys, true
+}
+
+// fetch many keys at once
+func batchGetHandler(w http.ResponseWriter, r *http.Request) {
+	klog.Info("Handling a batch get...")
+
+	keys, ok := decodeBatchRequest(w, r, operationRead)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := readContext(r)
+	defer cancel()
+
+	values, err := rdb.GetMany(ctx, keys...)
+	if err != nil {
+		writeCacheError(w, r, ctx, err)
+		return
+	}
+
+	result := BatchGetResult{
+		Values:  values,
+		Missing: []string{},
+	}
+	for _, key := range keys {
+		if _, ok := values[key]; !ok {
+			result.Missing = append(result.Missing, key)
+		}
+	}
+
+	err = encodeJSONBody(w, result)
+	if err != nil {
+		writeInternalError(w, r, err)
+	}
+}
+
+// delete many keys at once, answering how many of them existed
+func batchDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	klog.Info("Handling a batch delete...")
+
+	keys, ok := decodeBatchRequest(w, r, operationWrite)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	deleted, err := rdb.DeleteMany(ctx, keys...)
+	if err != nil {
+		writeCacheError(w, r, ctx, err)
+		return
+	}
+
+	err = encodeJSONBody(w, BatchDeleteResult{
+		Deleted: deleted,
+	})
+	if err != nil {
+		writeInternalError(w, r, err)
+	}
+}
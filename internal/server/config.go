@@ -2,7 +2,11 @@ package server
 
 import (
 	"fmt"
+	"math"
+	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 	"k8s.io/klog"
@@ -12,6 +16,10 @@ var (
 	configPrefix string = "redistester"
 )
 
+// the longest time.Duration there is, in whole seconds; a limit on how
+// long something may last has to stay under this or it overflows
+const maxDurationSeconds = int(math.MaxInt64 / int64(time.Second))
+
 type IConfig interface {
 	getKeyFile() string
 	setKeyFile(keyFile string)
@@ -31,6 +39,124 @@ type IConfig interface {
 	setDefaultTTL(ttl int)
 	getMaxBodySize() int
 	setMaxBodySize(size int)
+	getRedirectPort() int
+	setRedirectPort(redirectPort int)
+	getCertReloadInterval() int
+	setCertReloadInterval(certReloadInterval int)
+	getClientCAFile() string
+	setClientCAFile(clientCAFile string)
+	getClientAuth() string
+	setClientAuth(clientAuth string)
+	getDrainPeriod() int
+	setDrainPeriod(drainPeriod int)
+	getShutdownTimeout() int
+	setShutdownTimeout(shutdownTimeout int)
+	getCacheBackend() string
+	setCacheBackend(cacheBackend string)
+	getTracingExporter() string
+	setTracingExporter(tracingExporter string)
+	getTracingEndpoint() string
+	setTracingEndpoint(tracingEndpoint string)
+	getTracingFile() string
+	setTracingFile(tracingFile string)
+	getTracingHashKeys() bool
+	setTracingHashKeys(tracingHashKeys bool)
+	getCacheReadTimeout() int
+	setCacheReadTimeout(cacheReadTimeout int)
+	getCacheWriteTimeout() int
+	setCacheWriteTimeout(cacheWriteTimeout int)
+	getRedisMode() string
+	setRedisMode(redisMode string)
+	getRedisMasterName() string
+	setRedisMasterName(redisMasterName string)
+	getRedisSentinelAddresses() []string
+	setRedisSentinelAddresses(redisSentinelAddresses []string)
+	getRedisSentinelPassword() string
+	setRedisSentinelPassword(redisSentinelPassword string)
+	getRedisAddresses() []string
+	setRedisAddresses(redisAddresses []string)
+	getRedisUsername() string
+	setRedisUsername(redisUsername string)
+	getRedisTLSEnabled() bool
+	setRedisTLSEnabled(redisTLSEnabled bool)
+	getRedisTLSCAFile() string
+	setRedisTLSCAFile(redisTLSCAFile string)
+	getRedisTLSCertFile() string
+	setRedisTLSCertFile(redisTLSCertFile string)
+	getRedisTLSKeyFile() string
+	setRedisTLSKeyFile(redisTLSKeyFile string)
+	getRedisTLSServerName() string
+	setRedisTLSServerName(redisTLSServerName string)
+	getRedisTLSInsecureSkipVerify() bool
+	setRedisTLSInsecureSkipVerify(redisTLSInsecureSkipVerify bool)
+	getRedisPoolSize() int
+	setRedisPoolSize(redisPoolSize int)
+	getRedisMinIdleConns() int
+	setRedisMinIdleConns(redisMinIdleConns int)
+	getRedisPoolTimeout() int
+	setRedisPoolTimeout(redisPoolTimeout int)
+	getRedisDialTimeout() int
+	setRedisDialTimeout(redisDialTimeout int)
+	getRedisReadTimeout() int
+	setRedisReadTimeout(redisReadTimeout int)
+	getRedisWriteTimeout() int
+	setRedisWriteTimeout(redisWriteTimeout int)
+	getRedisMaxRetries() int
+	setRedisMaxRetries(redisMaxRetries int)
+	getRedisMinRetryBackoff() int
+	setRedisMinRetryBackoff(redisMinRetryBackoff int)
+	getRedisMaxRetryBackoff() int
+	setRedisMaxRetryBackoff(redisMaxRetryBackoff int)
+	validate() error
+	redact() IConfig
+	getCacheConnectMaxWait() int
+	setCacheConnectMaxWait(cacheConnectMaxWait int)
+	getCacheConnectMinBackoff() int
+	setCacheConnectMinBackoff(cacheConnectMinBackoff int)
+	getCacheConnectMaxBackoff() int
+	setCacheConnectMaxBackoff(cacheConnectMaxBackoff int)
+	getReadyzTimeout() int
+	setReadyzTimeout(readyzTimeout int)
+	getDebugEnabled() bool
+	setDebugEnabled(debugEnabled bool)
+	getDebugToken() string
+	setDebugToken(debugToken string)
+	getAPIKeysFile() string
+	setAPIKeysFile(apiKeysFile string)
+	getAPIKeys() []string
+	setAPIKeys(apiKeys []string)
+	getAPIKeysReloadInterval() int
+	setAPIKeysReloadInterval(apiKeysReloadInterval int)
+	getJWTJWKSURL() string
+	setJWTJWKSURL(jwtJWKSURL string)
+	getJWTJWKSFile() string
+	setJWTJWKSFile(jwtJWKSFile string)
+	getJWTIssuer() string
+	setJWTIssuer(jwtIssuer string)
+	getJWTAudience() string
+	setJWTAudience(jwtAudience string)
+	getJWTScopeClaim() string
+	setJWTScopeClaim(jwtScopeClaim string)
+	getJWTScopeMapping() []string
+	setJWTScopeMapping(jwtScopeMapping []string)
+	getKeyPolicyFile() string
+	setKeyPolicyFile(keyPolicyFile string)
+	getRateLimitBackend() string
+	setRateLimitBackend(rateLimitBackend string)
+	getRateLimits() []string
+	setRateLimits(rateLimits []string)
+	getWriteQuotaBytes() int
+	setWriteQuotaBytes(writeQuotaBytes int)
+	getLockDefaultTTL() int
+	setLockDefaultTTL(lockDefaultTTL int)
+	getRateLimitMaxLimit() int
+	setRateLimitMaxLimit(rateLimitMaxLimit int)
+	getJWTLeeway() int
+	setJWTLeeway(jwtLeeway int)
+	getRateLimitMaxPeriod() int
+	setRateLimitMaxPeriod(rateLimitMaxPeriod int)
+	getLockMaxTTL() int
+	setLockMaxTTL(lockMaxTTL int)
 }
 
 func (c *Config) getCertFile() string {
@@ -105,16 +231,538 @@ func (c *Config) setMaxBodySize(size int) {
 	c.MaxBodySize = size
 }
 
+func (c *Config) getRedirectPort() int {
+	return c.RedirectPort
+}
+
+func (c *Config) setRedirectPort(redirectPort int) {
+	c.RedirectPort = redirectPort
+}
+
+func (c *Config) getCertReloadInterval() int {
+	return c.CertReloadInterval
+}
+
+func (c *Config) setCertReloadInterval(certReloadInterval int) {
+	c.CertReloadInterval = certReloadInterval
+}
+
+func (c *Config) getClientCAFile() string {
+	return c.ClientCAFile
+}
+
+func (c *Config) setClientCAFile(clientCAFile string) {
+	c.ClientCAFile = clientCAFile
+}
+
+func (c *Config) getClientAuth() string {
+	return c.ClientAuth
+}
+
+func (c *Config) setClientAuth(clientAuth string) {
+	c.ClientAuth = clientAuth
+}
+
+func (c *Config) getDrainPeriod() int {
+	return c.DrainPeriod
+}
+
+func (c *Config) setDrainPeriod(drainPeriod int) {
+	c.DrainPeriod = drainPeriod
+}
+
+func (c *Config) getShutdownTimeout() int {
+	return c.ShutdownTimeout
+}
+
+func (c *Config) setShutdownTimeout(shutdownTimeout int) {
+	c.ShutdownTimeout = shutdownTimeout
+}
+
+func (c *Config) getCacheBackend() string {
+	return c.CacheBackend
+}
+
+func (c *Config) setCacheBackend(cacheBackend string) {
+	c.CacheBackend = cacheBackend
+}
+
+func (c *Config) getTracingExporter() string {
+	return c.TracingExporter
+}
+
+func (c *Config) setTracingExporter(tracingExporter string) {
+	c.TracingExporter = tracingExporter
+}
+
+func (c *Config) getTracingEndpoint() string {
+	return c.TracingEndpoint
+}
+
+func (c *Config) setTracingEndpoint(tracingEndpoint string) {
+	c.TracingEndpoint = tracingEndpoint
+}
+
+func (c *Config) getTracingFile() string {
+	return c.TracingFile
+}
+
+func (c *Config) setTracingFile(tracingFile string) {
+	c.TracingFile = tracingFile
+}
+
+func (c *Config) getTracingHashKeys() bool {
+	return c.TracingHashKeys
+}
+
+func (c *Config) setTracingHashKeys(tracingHashKeys bool) {
+	c.TracingHashKeys = tracingHashKeys
+}
+
+func (c *Config) getCacheReadTimeout() int {
+	return c.CacheReadTimeout
+}
+
+func (c *Config) setCacheReadTimeout(cacheReadTimeout int) {
+	c.CacheReadTimeout = cacheReadTimeout
+}
+
+func (c *Config) getCacheWriteTimeout() int {
+	return c.CacheWriteTimeout
+}
+
+func (c *Config) setCacheWriteTimeout(cacheWriteTimeout int) {
+	c.CacheWriteTimeout = cacheWriteTimeout
+}
+
+func (c *Config) getRedisMode() string {
+	return c.RedisMode
+}
+
+func (c *Config) setRedisMode(redisMode string) {
+	c.RedisMode = redisMode
+}
+
+func (c *Config) getRedisMasterName() string {
+	return c.RedisMasterName
+}
+
+func (c *Config) setRedisMasterName(redisMasterName string) {
+	c.RedisMasterName = redisMasterName
+}
+
+func (c *Config) getRedisSentinelAddresses() []string {
+	return c.RedisSentinelAddresses
+}
+
+func (c *Config) setRedisSentinelAddresses(redisSentinelAddresses []string) {
+	c.RedisSentinelAddresses = redisSentinelAddresses
+}
+
+func (c *Config) getRedisSentinelPassword() string {
+	return c.RedisSentinelPassword
+}
+
+func (c *Config) setRedisSentinelPassword(redisSentinelPassword string) {
+	c.RedisSentinelPassword = redisSentinelPassword
+}
+
+func (c *Config) getRedisAddresses() []string {
+	return c.RedisAddresses
+}
+
+func (c *Config) setRedisAddresses(redisAddresses []string) {
+	c.RedisAddresses = redisAddresses
+}
+
+func (c *Config) getRedisUsername() string {
+	return c.RedisUsername
+}
+
+func (c *Config) setRedisUsername(redisUsername string) {
+	c.RedisUsername = redisUsername
+}
+
+func (c *Config) getRedisTLSEnabled() bool {
+	return c.RedisTLSEnabled
+}
+
+func (c *Config) setRedisTLSEnabled(redisTLSEnabled bool) {
+	c.RedisTLSEnabled = redisTLSEnabled
+}
+
+func (c *Config) getRedisTLSCAFile() string {
+	return c.RedisTLSCAFile
+}
+
+func (c *Config) setRedisTLSCAFile(redisTLSCAFile string) {
+	c.RedisTLSCAFile = redisTLSCAFile
+}
+
+func (c *Config) getRedisTLSCertFile() string {
+	return c.RedisTLSCertFile
+}
+
+func (c *Config) setRedisTLSCertFile(redisTLSCertFile string) {
+	c.RedisTLSCertFile = redisTLSCertFile
+}
+
+func (c *Config) getRedisTLSKeyFile() string {
+	return c.RedisTLSKeyFile
+}
+
+func (c *Config) setRedisTLSKeyFile(redisTLSKeyFile string) {
+	c.RedisTLSKeyFile = redisTLSKeyFile
+}
+
+func (c *Config) getRedisTLSServerName() string {
+	return c.RedisTLSServerName
+}
+
+func (c *Config) setRedisTLSServerName(redisTLSServerName string) {
+	c.RedisTLSServerName = redisTLSServerName
+}
+
+func (c *Config) getRedisTLSInsecureSkipVerify() bool {
+	return c.RedisTLSInsecureSkipVerify
+}
+
+func (c *Config) setRedisTLSInsecureSkipVerify(redisTLSInsecureSkipVerify bool) {
+	c.RedisTLSInsecureSkipVerify = redisTLSInsecureSkipVerify
+}
+
+func (c *Config) getRedisPoolSize() int {
+	return c.RedisPoolSize
+}
+
+func (c *Config) setRedisPoolSize(redisPoolSize int) {
+	c.RedisPoolSize = redisPoolSize
+}
+
+func (c *Config) getRedisMinIdleConns() int {
+	return c.RedisMinIdleConns
+}
+
+func (c *Config) setRedisMinIdleConns(redisMinIdleConns int) {
+	c.RedisMinIdleConns = redisMinIdleConns
+}
+
+func (c *Config) getRedisPoolTimeout() int {
+	return c.RedisPoolTimeout
+}
+
+func (c *Config) setRedisPoolTimeout(redisPoolTimeout int) {
+	c.RedisPoolTimeout = redisPoolTimeout
+}
+
+func (c *Config) getRedisDialTimeout() int {
+	return c.RedisDialTimeout
+}
+
+func (c *Config) setRedisDialTimeout(redisDialTimeout int) {
+	c.RedisDialTimeout = redisDialTimeout
+}
+
+func (c *Config) getRedisReadTimeout() int {
+	return c.RedisReadTimeout
+}
+
+func (c *Config) setRedisReadTimeout(redisReadTimeout int) {
+	c.RedisReadTimeout = redisReadTimeout
+}
+
+func (c *Config) getRedisWriteTimeout() int {
+	return c.RedisWriteTimeout
+}
+
+func (c *Config) setRedisWriteTimeout(redisWriteTimeout int) {
+	c.RedisWriteTimeout = redisWriteTimeout
+}
+
+func (c *Config) getRedisMaxRetries() int {
+	return c.RedisMaxRetries
+}
+
+func (c *Config) setRedisMaxRetries(redisMaxRetries int) {
+	c.RedisMaxRetries = redisMaxRetries
+}
+
+func (c *Config) getRedisMinRetryBackoff() int {
+	return c.RedisMinRetryBackoff
+}
+
+func (c *Config) setRedisMinRetryBackoff(redisMinRetryBackoff int) {
+	c.RedisMinRetryBackoff = redisMinRetryBackoff
+}
+
+func (c *Config) getRedisMaxRetryBackoff() int {
+	return c.RedisMaxRetryBackoff
+}
+
+func (c *Config) setRedisMaxRetryBackoff(redisMaxRetryBackoff int) {
+	c.RedisMaxRetryBackoff = redisMaxRetryBackoff
+}
+
+func (c *Config) getCacheConnectMaxWait() int {
+	return c.CacheConnectMaxWait
+}
+
+func (c *Config) setCacheConnectMaxWait(cacheConnectMaxWait int) {
+	c.CacheConnectMaxWait = cacheConnectMaxWait
+}
+
+func (c *Config) getCacheConnectMinBackoff() int {
+	return c.CacheConnectMinBackoff
+}
+
+func (c *Config) setCacheConnectMinBackoff(cacheConnectMinBackoff int) {
+	c.CacheConnectMinBackoff = cacheConnectMinBackoff
+}
+
+func (c *Config) getCacheConnectMaxBackoff() int {
+	return c.CacheConnectMaxBackoff
+}
+
+func (c *Config) setCacheConnectMaxBackoff(cacheConnectMaxBackoff int) {
+	c.CacheConnectMaxBackoff = cacheConnectMaxBackoff
+}
+
+func (c *Config) getReadyzTimeout() int {
+	return c.ReadyzTimeout
+}
+
+func (c *Config) setReadyzTimeout(readyzTimeout int) {
+	c.ReadyzTimeout = readyzTimeout
+}
+
+func (c *Config) getDebugEnabled() bool {
+	return c.DebugEnabled
+}
+
+func (c *Config) setDebugEnabled(debugEnabled bool) {
+	c.DebugEnabled = debugEnabled
+}
+
+func (c *Config) getDebugToken() string {
+	return c.DebugToken
+}
+
+func (c *Config) setDebugToken(debugToken string) {
+	c.DebugToken = debugToken
+}
+
+func (c *Config) getAPIKeysFile() string {
+	return c.APIKeysFile
+}
+
+func (c *Config) setAPIKeysFile(apiKeysFile string) {
+	c.APIKeysFile = apiKeysFile
+}
+
+func (c *Config) getAPIKeys() []string {
+	return c.APIKeys
+}
+
+func (c *Config) setAPIKeys(apiKeys []string) {
+	c.APIKeys = apiKeys
+}
+
+func (c *Config) getAPIKeysReloadInterval() int {
+	return c.APIKeysReloadInterval
+}
+
+func (c *Config) setAPIKeysReloadInterval(apiKeysReloadInterval int) {
+	c.APIKeysReloadInterval = apiKeysReloadInterval
+}
+
+func (c *Config) getJWTJWKSURL() string {
+	return c.JWTJWKSURL
+}
+
+func (c *Config) setJWTJWKSURL(jwtJWKSURL string) {
+	c.JWTJWKSURL = jwtJWKSURL
+}
+
+func (c *Config) getJWTJWKSFile() string {
+	return c.JWTJWKSFile
+}
+
+func (c *Config) setJWTJWKSFile(jwtJWKSFile string) {
+	c.JWTJWKSFile = jwtJWKSFile
+}
+
+func (c *Config) getJWTIssuer() string {
+	return c.JWTIssuer
+}
+
+func (c *Config) setJWTIssuer(jwtIssuer string) {
+	c.JWTIssuer = jwtIssuer
+}
+
+func (c *Config) getJWTAudience() string {
+	return c.JWTAudience
+}
+
+func (c *Config) setJWTAudience(jwtAudience string) {
+	c.JWTAudience = jwtAudience
+}
+
+func (c *Config) getJWTScopeClaim() string {
+	return c.JWTScopeClaim
+}
+
+func (c *Config) setJWTScopeClaim(jwtScopeClaim string) {
+	c.JWTScopeClaim = jwtScopeClaim
+}
+
+func (c *Config) getJWTScopeMapping() []string {
+	return c.JWTScopeMapping
+}
+
+func (c *Config) setJWTScopeMapping(jwtScopeMapping []string) {
+	c.JWTScopeMapping = jwtScopeMapping
+}
+
+func (c *Config) getKeyPolicyFile() string {
+	return c.KeyPolicyFile
+}
+
+func (c *Config) setKeyPolicyFile(keyPolicyFile string) {
+	c.KeyPolicyFile = keyPolicyFile
+}
+
+func (c *Config) getRateLimitBackend() string {
+	return c.RateLimitBackend
+}
+
+func (c *Config) setRateLimitBackend(rateLimitBackend string) {
+	c.RateLimitBackend = rateLimitBackend
+}
+
+func (c *Config) getRateLimits() []string {
+	return c.RateLimits
+}
+
+func (c *Config) setRateLimits(rateLimits []string) {
+	c.RateLimits = rateLimits
+}
+
+func (c *Config) getWriteQuotaBytes() int {
+	return c.WriteQuotaBytes
+}
+
+func (c *Config) setWriteQuotaBytes(writeQuotaBytes int) {
+	c.WriteQuotaBytes = writeQuotaBytes
+}
+
+func (c *Config) getLockDefaultTTL() int {
+	return c.LockDefaultTTL
+}
+
+func (c *Config) setLockDefaultTTL(lockDefaultTTL int) {
+	c.LockDefaultTTL = lockDefaultTTL
+}
+
+func (c *Config) getRateLimitMaxLimit() int {
+	return c.RateLimitMaxLimit
+}
+
+func (c *Config) setRateLimitMaxLimit(rateLimitMaxLimit int) {
+	c.RateLimitMaxLimit = rateLimitMaxLimit
+}
+
+func (c *Config) getJWTLeeway() int {
+	return c.JWTLeeway
+}
+
+func (c *Config) setJWTLeeway(jwtLeeway int) {
+	c.JWTLeeway = jwtLeeway
+}
+
+func (c *Config) getRateLimitMaxPeriod() int {
+	return c.RateLimitMaxPeriod
+}
+
+func (c *Config) setRateLimitMaxPeriod(rateLimitMaxPeriod int) {
+	c.RateLimitMaxPeriod = rateLimitMaxPeriod
+}
+
+func (c *Config) getLockMaxTTL() int {
+	return c.LockMaxTTL
+}
+
+func (c *Config) setLockMaxTTL(lockMaxTTL int) {
+	c.LockMaxTTL = lockMaxTTL
+}
+
 type Config struct {
-	CertFile      string
-	KeyFile       string
-	Port          int
-	RedisAddress  string
-	RedisPort     int
-	RedisPassword string
-	RedisDB       int
-	DefaultTTL    int
-	MaxBodySize   int
+	CertFile                   string
+	KeyFile                    string
+	Port                       int
+	RedisAddress               string
+	RedisPort                  int
+	RedisPassword              string
+	RedisDB                    int
+	DefaultTTL                 int
+	MaxBodySize                int
+	RedirectPort               int
+	CertReloadInterval         int
+	ClientCAFile               string
+	ClientAuth                 string
+	DrainPeriod                int
+	ShutdownTimeout            int
+	CacheBackend               string
+	TracingExporter            string
+	TracingEndpoint            string
+	TracingFile                string
+	TracingHashKeys            bool
+	CacheReadTimeout           int
+	CacheWriteTimeout          int
+	RedisMode                  string
+	RedisMasterName            string
+	RedisSentinelAddresses     []string
+	RedisSentinelPassword      string
+	RedisAddresses             []string
+	RedisUsername              string
+	RedisTLSEnabled            bool
+	RedisTLSCAFile             string
+	RedisTLSCertFile           string
+	RedisTLSKeyFile            string
+	RedisTLSServerName         string
+	RedisTLSInsecureSkipVerify bool
+	RedisPoolSize              int
+	RedisMinIdleConns          int
+	RedisPoolTimeout           int
+	RedisDialTimeout           int
+	RedisReadTimeout           int
+	RedisWriteTimeout          int
+	RedisMaxRetries            int
+	RedisMinRetryBackoff       int
+	RedisMaxRetryBackoff       int
+	CacheConnectMaxWait        int
+	CacheConnectMinBackoff     int
+	CacheConnectMaxBackoff     int
+	ReadyzTimeout              int
+	DebugEnabled               bool
+	DebugToken                 string
+	APIKeysFile                string
+	APIKeys                    []string
+	APIKeysReloadInterval      int
+	JWTJWKSURL                 string
+	JWTJWKSFile                string
+	JWTIssuer                  string
+	JWTAudience                string
+	JWTScopeClaim              string
+	JWTScopeMapping            []string
+	KeyPolicyFile              string
+	RateLimitBackend           string
+	RateLimits                 []string
+	WriteQuotaBytes            int
+	LockDefaultTTL             int
+	RateLimitMaxLimit          int
+	JWTLeeway                  int
+	RateLimitMaxPeriod         int
+	LockMaxTTL                 int
 }
 
 func setConfigDefaults() {
@@ -127,6 +775,64 @@ func setConfigDefaults() {
 	viper.SetDefault("server.redis-db", 0)
 	viper.SetDefault("server.default-ttl", 300)
 	viper.SetDefault("server.max-body-size", 1048576)
+	viper.SetDefault("server.redirect-port", 0)
+	viper.SetDefault("server.cert-reload-interval", 30)
+	viper.SetDefault("server.client-ca-file", "")
+	viper.SetDefault("server.client-auth", "none")
+	viper.SetDefault("server.drain-period", 5)
+	viper.SetDefault("server.shutdown-timeout", 30)
+	viper.SetDefault("server.cache-backend", "redis")
+	viper.SetDefault("server.tracing-exporter", "none")
+	viper.SetDefault("server.tracing-endpoint", "http://localhost:4318")
+	viper.SetDefault("server.tracing-file", "")
+	viper.SetDefault("server.tracing-hash-keys", false)
+	viper.SetDefault("server.cache-read-timeout-ms", 1000)
+	viper.SetDefault("server.cache-write-timeout-ms", 2000)
+	viper.SetDefault("server.redis-mode", "standalone")
+	viper.SetDefault("server.redis-master-name", "")
+	viper.SetDefault("server.redis-sentinel-addresses", []string{})
+	viper.SetDefault("server.redis-sentinel-password", "")
+	viper.SetDefault("server.redis-addresses", []string{})
+	viper.SetDefault("server.redis-username", "")
+	viper.SetDefault("server.redis-tls-enabled", false)
+	viper.SetDefault("server.redis-tls-ca-file", "")
+	viper.SetDefault("server.redis-tls-cert-file", "")
+	viper.SetDefault("server.redis-tls-key-file", "")
+	viper.SetDefault("server.redis-tls-server-name", "")
+	viper.SetDefault("server.redis-tls-insecure-skip-verify", false)
+	viper.SetDefault("server.redis-pool-size", 0)
+	viper.SetDefault("server.redis-min-idle-conns", 0)
+	viper.SetDefault("server.redis-pool-timeout-ms", 0)
+	viper.SetDefault("server.redis-dial-timeout-ms", 5000)
+	viper.SetDefault("server.redis-read-timeout-ms", 3000)
+	viper.SetDefault("server.redis-write-timeout-ms", 3000)
+	viper.SetDefault("server.redis-max-retries", 3)
+	viper.SetDefault("server.redis-min-retry-backoff-ms", 8)
+	viper.SetDefault("server.redis-max-retry-backoff-ms", 512)
+	viper.SetDefault("server.cache-connect-max-wait", 300)
+	viper.SetDefault("server.cache-connect-min-backoff-ms", 250)
+	viper.SetDefault("server.cache-connect-max-backoff-ms", 10000)
+	viper.SetDefault("server.readyz-timeout-ms", 1000)
+	viper.SetDefault("server.debug-enabled", false)
+	viper.SetDefault("server.debug-token", "")
+	viper.SetDefault("server.api-keys-file", "")
+	viper.SetDefault("server.api-keys", []string{})
+	viper.SetDefault("server.api-keys-reload-interval", 30)
+	viper.SetDefault("server.jwt-jwks-url", "")
+	viper.SetDefault("server.jwt-jwks-file", "")
+	viper.SetDefault("server.jwt-issuer", "")
+	viper.SetDefault("server.jwt-audience", "")
+	viper.SetDefault("server.jwt-scope-claim", "scope")
+	viper.SetDefault("server.jwt-scope-mapping", []string{})
+	viper.SetDefault("server.key-policy-file", "")
+	viper.SetDefault("server.rate-limit-backend", "none")
+	viper.SetDefault("server.rate-limits", []string{})
+	viper.SetDefault("server.write-quota-bytes", 0)
+	viper.SetDefault("server.lock-default-ttl", 30)
+	viper.SetDefault("server.ratelimit-max-limit", 10000)
+	viper.SetDefault("server.jwt-leeway", 30)
+	viper.SetDefault("server.ratelimit-max-period", 86400)
+	viper.SetDefault("server.lock-max-ttl", 3600)
 }
 
 func bindConfigEnvironment() {
@@ -140,6 +846,64 @@ func bindConfigEnvironment() {
 	viper.BindEnv("server.redis-db", fmt.Sprintf("%s_SERVER_REDIS_DB", strings.ToUpper(configPrefix)))
 	viper.BindEnv("server.default-ttl", fmt.Sprintf("%s_SERVER_DEFAULT_TTL", strings.ToUpper(configPrefix)))
 	viper.BindEnv("server.max-body-size", fmt.Sprintf("%s_SERVER_MAX_BODY_SIZE", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redirect-port", fmt.Sprintf("%s_SERVER_REDIRECT_PORT", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.cert-reload-interval", fmt.Sprintf("%s_SERVER_CERT_RELOAD_INTERVAL", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.client-ca-file", fmt.Sprintf("%s_SERVER_CLIENT_CA_FILE", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.client-auth", fmt.Sprintf("%s_SERVER_CLIENT_AUTH", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.drain-period", fmt.Sprintf("%s_SERVER_DRAIN_PERIOD", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.shutdown-timeout", fmt.Sprintf("%s_SERVER_SHUTDOWN_TIMEOUT", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.cache-backend", fmt.Sprintf("%s_SERVER_CACHE_BACKEND", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.tracing-exporter", fmt.Sprintf("%s_SERVER_TRACING_EXPORTER", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.tracing-endpoint", fmt.Sprintf("%s_SERVER_TRACING_ENDPOINT", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.tracing-file", fmt.Sprintf("%s_SERVER_TRACING_FILE", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.tracing-hash-keys", fmt.Sprintf("%s_SERVER_TRACING_HASH_KEYS", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.cache-read-timeout-ms", fmt.Sprintf("%s_SERVER_CACHE_READ_TIMEOUT_MS", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.cache-write-timeout-ms", fmt.Sprintf("%s_SERVER_CACHE_WRITE_TIMEOUT_MS", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-mode", fmt.Sprintf("%s_SERVER_REDIS_MODE", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-master-name", fmt.Sprintf("%s_SERVER_REDIS_MASTER_NAME", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-sentinel-addresses", fmt.Sprintf("%s_SERVER_REDIS_SENTINEL_ADDRESSES", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-sentinel-password", fmt.Sprintf("%s_SERVER_REDIS_SENTINEL_PASSWORD", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-addresses", fmt.Sprintf("%s_SERVER_REDIS_ADDRESSES", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-username", fmt.Sprintf("%s_SERVER_REDIS_USERNAME", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-tls-enabled", fmt.Sprintf("%s_SERVER_REDIS_TLS_ENABLED", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-tls-ca-file", fmt.Sprintf("%s_SERVER_REDIS_TLS_CA_FILE", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-tls-cert-file", fmt.Sprintf("%s_SERVER_REDIS_TLS_CERT_FILE", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-tls-key-file", fmt.Sprintf("%s_SERVER_REDIS_TLS_KEY_FILE", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-tls-server-name", fmt.Sprintf("%s_SERVER_REDIS_TLS_SERVER_NAME", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-tls-insecure-skip-verify", fmt.Sprintf("%s_SERVER_REDIS_TLS_INSECURE_SKIP_VERIFY", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-pool-size", fmt.Sprintf("%s_SERVER_REDIS_POOL_SIZE", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-min-idle-conns", fmt.Sprintf("%s_SERVER_REDIS_MIN_IDLE_CONNS", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-pool-timeout-ms", fmt.Sprintf("%s_SERVER_REDIS_POOL_TIMEOUT_MS", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-dial-timeout-ms", fmt.Sprintf("%s_SERVER_REDIS_DIAL_TIMEOUT_MS", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-read-timeout-ms", fmt.Sprintf("%s_SERVER_REDIS_READ_TIMEOUT_MS", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-write-timeout-ms", fmt.Sprintf("%s_SERVER_REDIS_WRITE_TIMEOUT_MS", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-max-retries", fmt.Sprintf("%s_SERVER_REDIS_MAX_RETRIES", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-min-retry-backoff-ms", fmt.Sprintf("%s_SERVER_REDIS_MIN_RETRY_BACKOFF_MS", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.redis-max-retry-backoff-ms", fmt.Sprintf("%s_SERVER_REDIS_MAX_RETRY_BACKOFF_MS", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.cache-connect-max-wait", fmt.Sprintf("%s_SERVER_CACHE_CONNECT_MAX_WAIT", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.cache-connect-min-backoff-ms", fmt.Sprintf("%s_SERVER_CACHE_CONNECT_MIN_BACKOFF_MS", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.cache-connect-max-backoff-ms", fmt.Sprintf("%s_SERVER_CACHE_CONNECT_MAX_BACKOFF_MS", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.readyz-timeout-ms", fmt.Sprintf("%s_SERVER_READYZ_TIMEOUT_MS", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.debug-enabled", fmt.Sprintf("%s_SERVER_DEBUG_ENABLED", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.debug-token", fmt.Sprintf("%s_SERVER_DEBUG_TOKEN", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.api-keys-file", fmt.Sprintf("%s_SERVER_API_KEYS_FILE", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.api-keys", fmt.Sprintf("%s_SERVER_API_KEYS", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.api-keys-reload-interval", fmt.Sprintf("%s_SERVER_API_KEYS_RELOAD_INTERVAL", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.jwt-jwks-url", fmt.Sprintf("%s_SERVER_JWT_JWKS_URL", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.jwt-jwks-file", fmt.Sprintf("%s_SERVER_JWT_JWKS_FILE", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.jwt-issuer", fmt.Sprintf("%s_SERVER_JWT_ISSUER", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.jwt-audience", fmt.Sprintf("%s_SERVER_JWT_AUDIENCE", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.jwt-scope-claim", fmt.Sprintf("%s_SERVER_JWT_SCOPE_CLAIM", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.jwt-scope-mapping", fmt.Sprintf("%s_SERVER_JWT_SCOPE_MAPPING", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.key-policy-file", fmt.Sprintf("%s_SERVER_KEY_POLICY_FILE", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.rate-limit-backend", fmt.Sprintf("%s_SERVER_RATE_LIMIT_BACKEND", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.rate-limits", fmt.Sprintf("%s_SERVER_RATE_LIMITS", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.write-quota-bytes", fmt.Sprintf("%s_SERVER_WRITE_QUOTA_BYTES", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.lock-default-ttl", fmt.Sprintf("%s_SERVER_LOCK_DEFAULT_TTL", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.ratelimit-max-limit", fmt.Sprintf("%s_SERVER_RATELIMIT_MAX_LIMIT", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.jwt-leeway", fmt.Sprintf("%s_SERVER_JWT_LEEWAY", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.ratelimit-max-period", fmt.Sprintf("%s_SERVER_RATELIMIT_MAX_PERIOD", strings.ToUpper(configPrefix)))
+	viper.BindEnv("server.lock-max-ttl", fmt.Sprintf("%s_SERVER_LOCK_MAX_TTL", strings.ToUpper(configPrefix)))
 }
 
 func configureConfigFile() {
@@ -151,6 +915,190 @@ func configureConfigFile() {
 	viper.AddConfigPath(".")                  // always search the app directory, because we should have a testing space
 }
 
+// what we print in place of a secret
+const redacted = "[REDACTED]"
+
+// return a copy of the config that's safe to print or log, with every
+// secret swapped out. Empty secrets are left empty so it's still obvious
+// when one hasn't been set.
+func (c *Config) redact() IConfig {
+	cp := *c
+	if cp.RedisPassword != "" {
+		cp.RedisPassword = redacted
+	}
+	if cp.RedisSentinelPassword != "" {
+		cp.RedisSentinelPassword = redacted
+	}
+	if cp.DebugToken != "" {
+		cp.DebugToken = redacted
+	}
+	return &cp
+}
+
+// the config keys holding secrets; anything that shows raw config values
+// (rather than going through redact) has to check this first
+var secretKeys = map[string]bool{
+	"server.redis-password":          true,
+	"server.redis-sentinel-password": true,
+	"server.debug-token":             true,
+}
+
+// the environment variable a config key is bound to, e.g.
+// server.redis-port is REDISTESTER_SERVER_REDIS_PORT
+func envName(key string) string {
+	return strings.ToUpper(configPrefix + "_" + strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// work out where the effective value of each config key came from. The
+// environment wins over the config file, which wins over our defaults,
+// the same order Viper resolves them in.
+func configSources() map[string]string {
+	sources := map[string]string{}
+	for _, key := range viper.AllKeys() {
+		switch {
+		case os.Getenv(envName(key)) != "":
+			sources[key] = "env"
+		case viper.InConfig(key):
+			sources[key] = "file"
+		default:
+			sources[key] = "default"
+		}
+	}
+	return sources
+}
+
+// check the settings that would otherwise only blow up (or quietly
+// misbehave) once we're under load; every problem is reported at once so
+// nobody has to fix their config one redeploy at a time
+func (c *Config) validate() error {
+	var problems []string
+
+	nonNegative := map[string]int{
+		"server.redis-pool-size":              c.RedisPoolSize,
+		"server.redis-min-idle-conns":         c.RedisMinIdleConns,
+		"server.redis-pool-timeout-ms":        c.RedisPoolTimeout,
+		"server.redis-dial-timeout-ms":        c.RedisDialTimeout,
+		"server.redis-min-retry-backoff-ms":   c.RedisMinRetryBackoff,
+		"server.redis-max-retry-backoff-ms":   c.RedisMaxRetryBackoff,
+		"server.cache-connect-max-wait":       c.CacheConnectMaxWait,
+		"server.cache-connect-max-backoff-ms": c.CacheConnectMaxBackoff,
+		"server.write-quota-bytes":            c.WriteQuotaBytes,
+		"server.jwt-leeway":                   c.JWTLeeway,
+	}
+	for key, value := range nonNegative {
+		if value < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative, got [%d]", key, value))
+		}
+	}
+
+	// zero isn't "off" for these; it's a timeout that's already passed
+	atLeastOne := map[string]int{
+		"server.cache-read-timeout-ms":        c.CacheReadTimeout,
+		"server.cache-write-timeout-ms":       c.CacheWriteTimeout,
+		"server.cache-connect-min-backoff-ms": c.CacheConnectMinBackoff,
+		"server.readyz-timeout-ms":            c.ReadyzTimeout,
+		"server.cert-reload-interval":         c.CertReloadInterval,
+		"server.api-keys-reload-interval":     c.APIKeysReloadInterval,
+	}
+	for key, value := range atLeastOne {
+		if value < 1 {
+			problems = append(problems, fmt.Sprintf("%s must be at least 1, got [%d]", key, value))
+		}
+	}
+
+	// go-redis treats -1 as "no timeout" for reads and writes, and as
+	// "no retries" for max retries, so those may go one lower
+	minusOneAllowed := map[string]int{
+		"server.redis-read-timeout-ms":  c.RedisReadTimeout,
+		"server.redis-write-timeout-ms": c.RedisWriteTimeout,
+		"server.redis-max-retries":      c.RedisMaxRetries,
+	}
+	for key, value := range minusOneAllowed {
+		if value < -1 {
+			problems = append(problems, fmt.Sprintf("%s must be -1 or more, got [%d]", key, value))
+		}
+	}
+
+	if c.RedisPoolSize > 0 && c.RedisMinIdleConns > c.RedisPoolSize {
+		problems = append(problems, fmt.Sprintf("server.redis-min-idle-conns [%d] must not be larger than server.redis-pool-size [%d]", c.RedisMinIdleConns, c.RedisPoolSize))
+	}
+
+	if c.RedisMaxRetryBackoff > 0 && c.RedisMinRetryBackoff > c.RedisMaxRetryBackoff {
+		problems = append(problems, fmt.Sprintf("server.redis-min-retry-backoff-ms [%d] must not be larger than server.redis-max-retry-backoff-ms [%d]", c.RedisMinRetryBackoff, c.RedisMaxRetryBackoff))
+	}
+
+	// a token from the right identity provider but meant for some other
+	// service must not get in, so issuer and audience aren't optional
+	if c.JWTJWKSURL != "" && c.JWTJWKSFile != "" {
+		problems = append(problems, "only one of server.jwt-jwks-url and server.jwt-jwks-file may be set")
+	}
+	if c.JWTJWKSURL != "" || c.JWTJWKSFile != "" {
+		if c.JWTIssuer == "" {
+			problems = append(problems, "server.jwt-issuer is required when JWT validation is turned on")
+		}
+		if c.JWTAudience == "" {
+			problems = append(problems, "server.jwt-audience is required when JWT validation is turned on")
+		}
+	}
+
+	switch c.RateLimitBackend {
+	case "none", "memory":
+	case "redis":
+		if c.CacheBackend != "redis" {
+			problems = append(problems, "server.rate-limit-backend [redis] needs server.cache-backend [redis]")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("Invalid server.rate-limit-backend [%s], supported backends are [none memory redis]", c.RateLimitBackend))
+	}
+	if c.RateLimitBackend == "none" && (c.WriteQuotaBytes > 0 || len(c.RateLimits) > 0) {
+		problems = append(problems, "server.rate-limits and server.write-quota-bytes need a server.rate-limit-backend")
+	}
+
+	if c.CacheConnectMinBackoff > c.CacheConnectMaxBackoff {
+		problems = append(problems, fmt.Sprintf("server.cache-connect-min-backoff-ms [%d] must not be larger than server.cache-connect-max-backoff-ms [%d]", c.CacheConnectMinBackoff, c.CacheConnectMaxBackoff))
+	}
+
+	if c.RateLimitMaxLimit < 1 {
+		problems = append(problems, fmt.Sprintf("server.ratelimit-max-limit must be at least 1, got [%d]", c.RateLimitMaxLimit))
+	}
+	if c.RateLimitMaxPeriod < 1 || c.RateLimitMaxPeriod > maxDurationSeconds {
+		problems = append(problems, fmt.Sprintf("server.ratelimit-max-period must be between 1 and %d seconds, got [%d]", maxDurationSeconds, c.RateLimitMaxPeriod))
+	}
+
+	if c.LockDefaultTTL < 1 {
+		problems = append(problems, fmt.Sprintf("server.lock-default-ttl must be at least 1 second, got [%d]", c.LockDefaultTTL))
+	}
+	if c.LockMaxTTL > maxDurationSeconds {
+		problems = append(problems, fmt.Sprintf("server.lock-max-ttl must be at most %d seconds, got [%d]", maxDurationSeconds, c.LockMaxTTL))
+	}
+	if c.LockDefaultTTL > c.LockMaxTTL {
+		problems = append(problems, fmt.Sprintf("server.lock-default-ttl [%d] must not be larger than server.lock-max-ttl [%d]", c.LockDefaultTTL, c.LockMaxTTL))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	// map iteration order is random; sort so the message is stable
+	sort.Strings(problems)
+	return fmt.Errorf("Invalid configuration: %s", strings.Join(problems, "; "))
+}
+
+// read a list of strings from viper. Lists in the config file come
+// through as lists, but from the environment they're a single string,
+// so we also split on commas to allow "host1:26379,host2:26379"
+func getStringList(key string) []string {
+	var list []string
+	for _, v := range viper.GetStringSlice(key) {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
 func newConfig() IConfig {
 	// use Viper to set config defaults
 	setConfigDefaults()
@@ -172,14 +1120,72 @@ func newConfig() IConfig {
 	}
 
 	return &Config{
-		CertFile:      viper.GetString("server.cert-file"),
-		KeyFile:       viper.GetString("server.key-file"),
-		Port:          viper.GetInt("server.port"),
-		RedisAddress:  viper.GetString("server.redis-address"),
-		RedisPort:     viper.GetInt("server.redis-port"),
-		RedisPassword: viper.GetString("server.redis-password"),
-		RedisDB:       viper.GetInt("server.redis-db"),
-		DefaultTTL:    viper.GetInt("server.default-ttl"),
-		MaxBodySize:   viper.GetInt("server.max-body-size"),
+		CertFile:                   viper.GetString("server.cert-file"),
+		KeyFile:                    viper.GetString("server.key-file"),
+		Port:                       viper.GetInt("server.port"),
+		RedisAddress:               viper.GetString("server.redis-address"),
+		RedisPort:                  viper.GetInt("server.redis-port"),
+		RedisPassword:              viper.GetString("server.redis-password"),
+		RedisDB:                    viper.GetInt("server.redis-db"),
+		DefaultTTL:                 viper.GetInt("server.default-ttl"),
+		MaxBodySize:                viper.GetInt("server.max-body-size"),
+		RedirectPort:               viper.GetInt("server.redirect-port"),
+		CertReloadInterval:         viper.GetInt("server.cert-reload-interval"),
+		ClientCAFile:               viper.GetString("server.client-ca-file"),
+		ClientAuth:                 viper.GetString("server.client-auth"),
+		DrainPeriod:                viper.GetInt("server.drain-period"),
+		ShutdownTimeout:            viper.GetInt("server.shutdown-timeout"),
+		CacheBackend:               viper.GetString("server.cache-backend"),
+		TracingExporter:            viper.GetString("server.tracing-exporter"),
+		TracingEndpoint:            viper.GetString("server.tracing-endpoint"),
+		TracingFile:                viper.GetString("server.tracing-file"),
+		TracingHashKeys:            viper.GetBool("server.tracing-hash-keys"),
+		CacheReadTimeout:           viper.GetInt("server.cache-read-timeout-ms"),
+		CacheWriteTimeout:          viper.GetInt("server.cache-write-timeout-ms"),
+		RedisMode:                  viper.GetString("server.redis-mode"),
+		RedisMasterName:            viper.GetString("server.redis-master-name"),
+		RedisSentinelAddresses:     getStringList("server.redis-sentinel-addresses"),
+		RedisSentinelPassword:      viper.GetString("server.redis-sentinel-password"),
+		RedisAddresses:             getStringList("server.redis-addresses"),
+		RedisUsername:              viper.GetString("server.redis-username"),
+		RedisTLSEnabled:            viper.GetBool("server.redis-tls-enabled"),
+		RedisTLSCAFile:             viper.GetString("server.redis-tls-ca-file"),
+		RedisTLSCertFile:           viper.GetString("server.redis-tls-cert-file"),
+		RedisTLSKeyFile:            viper.GetString("server.redis-tls-key-file"),
+		RedisTLSServerName:         viper.GetString("server.redis-tls-server-name"),
+		RedisTLSInsecureSkipVerify: viper.GetBool("server.redis-tls-insecure-skip-verify"),
+		RedisPoolSize:              viper.GetInt("server.redis-pool-size"),
+		RedisMinIdleConns:          viper.GetInt("server.redis-min-idle-conns"),
+		RedisPoolTimeout:           viper.GetInt("server.redis-pool-timeout-ms"),
+		RedisDialTimeout:           viper.GetInt("server.redis-dial-timeout-ms"),
+		RedisReadTimeout:           viper.GetInt("server.redis-read-timeout-ms"),
+		RedisWriteTimeout:          viper.GetInt("server.redis-write-timeout-ms"),
+		RedisMaxRetries:            viper.GetInt("server.redis-max-retries"),
+		RedisMinRetryBackoff:       viper.GetInt("server.redis-min-retry-backoff-ms"),
+		RedisMaxRetryBackoff:       viper.GetInt("server.redis-max-retry-backoff-ms"),
+		CacheConnectMaxWait:        viper.GetInt("server.cache-connect-max-wait"),
+		CacheConnectMinBackoff:     viper.GetInt("server.cache-connect-min-backoff-ms"),
+		CacheConnectMaxBackoff:     viper.GetInt("server.cache-connect-max-backoff-ms"),
+		ReadyzTimeout:              viper.GetInt("server.readyz-timeout-ms"),
+		DebugEnabled:               viper.GetBool("server.debug-enabled"),
+		DebugToken:                 viper.GetString("server.debug-token"),
+		APIKeysFile:                viper.GetString("server.api-keys-file"),
+		APIKeys:                    getStringList("server.api-keys"),
+		APIKeysReloadInterval:      viper.GetInt("server.api-keys-reload-interval"),
+		JWTJWKSURL:                 viper.GetString("server.jwt-jwks-url"),
+		JWTJWKSFile:                viper.GetString("server.jwt-jwks-file"),
+		JWTIssuer:                  viper.GetString("server.jwt-issuer"),
+		JWTAudience:                viper.GetString("server.jwt-audience"),
+		JWTScopeClaim:              viper.GetString("server.jwt-scope-claim"),
+		JWTScopeMapping:            getStringList("server.jwt-scope-mapping"),
+		KeyPolicyFile:              viper.GetString("server.key-policy-file"),
+		RateLimitBackend:           viper.GetString("server.rate-limit-backend"),
+		RateLimits:                 getStringList("server.rate-limits"),
+		WriteQuotaBytes:            viper.GetInt("server.write-quota-bytes"),
+		LockDefaultTTL:             viper.GetInt("server.lock-default-ttl"),
+		RateLimitMaxLimit:          viper.GetInt("server.ratelimit-max-limit"),
+		JWTLeeway:                  viper.GetInt("server.jwt-leeway"),
+		RateLimitMaxPeriod:         viper.GetInt("server.ratelimit-max-period"),
+		LockMaxTTL:                 viper.GetInt("server.lock-max-ttl"),
 	}
 }
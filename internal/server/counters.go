@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	redisCache "github.com/blomquistr/go-redis-example/v2/internal/cache"
+	"k8s.io/klog"
+)
+
+// the prefix our counter resource lives under; everything after it in
+// the path is the counter's key
+const countersPath = "/v1/counters/"
+
+// a struct representing the body of a POST to /v1/counters/{key}. The
+// delta defaults to 1 and may be negative or fractional; the TTL, in
+// seconds, is only applied when the POST creates the counter.
+type CounterRequest struct {
+	Delta json.Number `json:"delta"`
+	TTL   int         `json:"ttl"`
+}
+
+// a struct representing a counter's value after a POST
+type CounterResult struct {
+	Key   string      `json:"key"`
+	Value json.Number `json:"value"`
+}
+
+// a handler for the /v1/counters/{key} resource, which adds to a counter
+// in one step, so concurrent callers never lose each other's updates
+func countersHandler(w http.ResponseWriter, r *http.Request) {
+	klog.Info("Handling a request for the counters resource...")
+
+	methods := []string{"POST"}
+	err := checkSupportedMethod(methods, r.Method)
+	if err != nil {
+		writeMethodNotAllowed(w, r, methods, err)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, countersPath)
+	if key == "" {
+		writeError(w, r, http.StatusBadRequest, "A key must be provided in the request path")
+		return
+	}
+
+	caller := identityFromContext(r.Context())
+	klog.Infof("Caller [%s] is sending a %s for counter [%s]", caller, r.Method, key)
+
+	if !authorizeKey(w, r, operationWrite, key) {
+		return
+	}
+
+	m := CounterRequest{
+		Delta: "1",
+		TTL:   config.getDefaultTTL(),
+	}
+
+	err = decodeJSONBody(w, r, &m)
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	// whole deltas use INCRBY, so the counter stays an integer; anything
+	// else has to go through INCRBYFLOAT
+	delta, intErr := m.Delta.Int64()
+	fdelta, floatErr := m.Delta.Float64()
+	if intErr != nil && floatErr != nil {
+		writeDecodeError(w, r, &malformedRequest{status: http.StatusBadRequest, msg: "The delta must be a number", field: "delta"})
+		return
+	}
+
+	if !consumeWriteQuota(w, r, len(key)+len(m.Delta)) {
+		return
+	}
+
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	var value string
+	var nan *redisCache.NotANumberError
+	var overflow *redisCache.OverflowError
+	var wrongType *redisCache.WrongTypeError
+	if intErr == nil {
+		var n int64
+		n, err = rdb.IncrBy(ctx, key, delta, m.TTL)
+		value = strconv.FormatInt(n, 10)
+	}
+	// a counter that's had a fractional delta added to it isn't an
+	// integer anymore, so whole deltas have to go through INCRBYFLOAT
+	// too. An integer counter that would overflow is a different story;
+	// quietly turning it into an imprecise float would be worse than
+	// refusing.
+	if intErr != nil || errors.As(err, &nan) {
+		var f float64
+		f, err = rdb.IncrByFloat(ctx, key, fdelta, m.TTL)
+		value = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	if errors.As(err, &overflow) {
+		writeProblem(w, r, Problem{
+			Type:   problemTypeCounterOverflow,
+			Title:  "Counter overflow",
+			Status: http.StatusConflict,
+			Detail: fmt.Sprintf("Incrementing key [%s] by [%s] would overflow it", key, m.Delta),
+			Key:    key,
+		})
+		return
+	}
+	if errors.As(err, &nan) {
+		writeProblem(w, r, Problem{
+			Type:   problemTypeNotANumber,
+			Title:  "Not a number",
+			Status: http.StatusConflict,
+			Detail: fmt.Sprintf("Key [%s] holds a value that can't be incremented by [%s]", key, m.Delta),
+			Key:    key,
+		})
+		return
+	}
+	if errors.As(err, &wrongType) {
+		writeProblem(w, r, Problem{
+			Type:   problemTypeWrongType,
+			Title:  "Wrong type",
+			Status: http.StatusConflict,
+			Detail: fmt.Sprintf("Key [%s] holds a hash, not a counter", key),
+			Key:    key,
+		})
+		return
+	}
+	if err != nil {
+		writeCacheError(w, r, ctx, err)
+		return
+	}
+
+	err = encodeJSONBody(w, CounterResult{
+		Key:   key,
+		Value: json.Number(value),
+	})
+	if err != nil {
+		writeInternalError(w, r, err)
+	}
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	redisCache "github.com/blomquistr/go-redis-example/v2/internal/cache"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"k8s.io/klog"
+)
+
+// set at build time with, e.g.
+//
+//	go build -ldflags "-X github.com/blomquistr/go-redis-example/v2/internal/server.version=v1.2.3"
+//
+// when they're left empty we fall back on what the Go toolchain stamped
+// into the binary
+var (
+	version string
+	commit  string
+)
+
+// when the process started, for the uptime in /debug
+var startTime = time.Now()
+
+// a struct representing one config key in /debug: its effective value
+// and whether that came from a default, the config file or the environment
+type ConfigValue struct {
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// a struct representing the build the server is running
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+// a struct representing the Redis connection pool, both how it's
+// configured and how it's doing right now
+type PoolInfo struct {
+	Settings PoolSettings     `json:"settings"`
+	Stats    *redis.PoolStats `json:"stats"`
+}
+
+// a struct representing the pool settings; there's nothing secret in
+// here, so it doesn't need redacting
+type PoolSettings struct {
+	PoolSize          int `json:"poolSize"`
+	MinIdleConns      int `json:"minIdleConns"`
+	PoolTimeoutMs     int `json:"poolTimeoutMs"`
+	DialTimeoutMs     int `json:"dialTimeoutMs"`
+	ReadTimeoutMs     int `json:"readTimeoutMs"`
+	WriteTimeoutMs    int `json:"writeTimeoutMs"`
+	MaxRetries        int `json:"maxRetries"`
+	MinRetryBackoffMs int `json:"minRetryBackoffMs"`
+	MaxRetryBackoffMs int `json:"maxRetryBackoffMs"`
+}
+
+// a struct representing the body of /debug
+type DebugInfo struct {
+	Build      BuildInfo                    `json:"build"`
+	Uptime     string                       `json:"uptime"`
+	Goroutines int                          `json:"goroutines"`
+	ConfigFile string                       `json:"configFile,omitempty"`
+	Config     map[string]ConfigValue       `json:"config"`
+	Redis      map[string]map[string]string `json:"redis,omitempty"`
+	RedisError string                       `json:"redisError,omitempty"`
+	Pool       *PoolInfo                    `json:"pool,omitempty"`
+}
+
+// work out which build we're running, preferring whatever was passed in
+// with -ldflags over what the toolchain recorded
+func buildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" {
+			info.Version = bi.Main.Version
+		}
+		for _, setting := range bi.Settings {
+			if setting.Key == "vcs.revision" && info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+
+	return info
+}
+
+// the effective configuration with the source of each key; secrets only
+// ever show up as redacted, and only if they're actually set
+func debugConfig() map[string]ConfigValue {
+	values := map[string]ConfigValue{}
+	for key, source := range configSources() {
+		value := viper.Get(key)
+		if secretKeys[key] && viper.GetString(key) != "" {
+			value = redacted
+		}
+		values[key] = ConfigValue{
+			Value:  value,
+			Source: source,
+		}
+	}
+	return values
+}
+
+func redisPoolSettings() PoolSettings {
+	return PoolSettings{
+		PoolSize:          config.getRedisPoolSize(),
+		MinIdleConns:      config.getRedisMinIdleConns(),
+		PoolTimeoutMs:     config.getRedisPoolTimeout(),
+		DialTimeoutMs:     config.getRedisDialTimeout(),
+		ReadTimeoutMs:     config.getRedisReadTimeout(),
+		WriteTimeoutMs:    config.getRedisWriteTimeout(),
+		MaxRetries:        config.getRedisMaxRetries(),
+		MinRetryBackoffMs: config.getRedisMinRetryBackoff(),
+		MaxRetryBackoffMs: config.getRedisMaxRetryBackoff(),
+	}
+}
+
+// check the caller is allowed to see /debug. It's off unless someone
+// turns it on, and once it's on it wants either the debug token as a
+// bearer token or credentials with the admin scope. With neither a token
+// nor any other authentication configured, it's open.
+func debugAuthorized(r *http.Request) bool {
+	token := config.getDebugToken()
+	if token != "" {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			return true
+		}
+	}
+
+	if apiKeys == nil && tokens == nil {
+		return token == ""
+	}
+
+	id := authenticate(r)
+	return id != nil && id.hasScope(scopeAdmin)
+}
+
+// function to dump some debugging information as JSON - keep tacking on
+// more debug info later, but never anything that isn't redacted
+func debugHandler(w http.ResponseWriter, r *http.Request) {
+	// pretend there's nothing here at all when /debug is turned off
+	if !config.getDebugEnabled() {
+		writeError(w, r, http.StatusNotFound, "Not found")
+		return
+	}
+	if !debugAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="debug"`)
+		writeError(w, r, http.StatusUnauthorized, "A valid debug token or admin credentials are required")
+		return
+	}
+
+	klog.Info("Dumping debug information...")
+
+	info := DebugInfo{
+		Build:      buildInfo(),
+		Uptime:     time.Since(startTime).Round(time.Second).String(),
+		Goroutines: runtime.NumGoroutine(),
+		ConfigFile: viper.ConfigFileUsed(),
+		Config:     debugConfig(),
+	}
+
+	// INFO and the pool only exist for the Redis backend. A Redis that
+	// isn't answering is exactly when someone reaches for /debug, so we
+	// report the error rather than failing the whole request
+	if db, ok := rdb.(*redisCache.Database); ok {
+		ctx, cancel := readContext(r)
+		defer cancel()
+
+		redisInfo, err := db.Info(ctx, "server", "memory")
+		if err != nil {
+			klog.Errorf("Error fetching Redis INFO: %s", err.Error())
+			info.RedisError = err.Error()
+		}
+		info.Redis = redisInfo
+		info.Pool = &PoolInfo{
+			Settings: redisPoolSettings(),
+			Stats:    db.Client.PoolStats(),
+		}
+	}
+
+	err := encodeJSONBody(w, info)
+	if err != nil {
+		writeInternalError(w, r, err)
+	}
+}
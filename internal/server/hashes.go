@@ -0,0 +1,322 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	redisCache "github.com/blomquistr/go-redis-example/v2/internal/cache"
+	"k8s.io/klog"
+)
+
+// the prefix our hash resource lives under. What follows is the key and,
+// optionally, a field of it: /v1/hashes/{key} or /v1/hashes/{key}/{field}.
+// The key ends at the first slash, so keys used here can't contain one.
+const hashesPath = "/v1/hashes/"
+
+// a struct representing the body of a PUT or PATCH to /v1/hashes/{key}.
+// A PUT replaces the whole hash and the TTL falls back to our configured
+// default; a PATCH only sets the fields given and, without a TTL, leaves
+// the hash's expiry as it was.
+type HashRequest struct {
+	Fields map[string]string `json:"fields"`
+	TTL    *int              `json:"ttl"`
+}
+
+// a struct representing the body of a PUT to /v1/hashes/{key}/{field}
+type HashFieldRequest struct {
+	Value string `json:"value"`
+	TTL   *int   `json:"ttl"`
+}
+
+// a struct representing a whole hash, returned from GET, PUT and PATCH
+type HashResult struct {
+	Key    string            `json:"key"`
+	Fields map[string]string `json:"fields"`
+}
+
+// a struct representing one field of a hash
+type HashFieldResult struct {
+	Key   string `json:"key"`
+	Field string `json:"field"`
+	Value string `json:"value"`
+}
+
+// a single handler for the /v1/hashes/{key}[/{field}] resource; it works
+// out the key and field and then hands off to a handler per method
+func hashesHandler(w http.ResponseWriter, r *http.Request) {
+	klog.Info("Handling a request for the hashes resource...")
+
+	key, field, hasField := strings.Cut(strings.TrimPrefix(r.URL.Path, hashesPath), "/")
+
+	// PATCH is how several fields change at once, so it only makes sense
+	// on the whole hash
+	methods := []string{"GET", "PUT", "PATCH", "DELETE"}
+	if hasField {
+		methods = []string{"GET", "PUT", "DELETE"}
+	}
+	err := checkSupportedMethod(methods, r.Method)
+	if err != nil {
+		writeMethodNotAllowed(w, r, methods, err)
+		return
+	}
+
+	if key == "" {
+		writeError(w, r, http.StatusBadRequest, "A key must be provided in the request path")
+		return
+	}
+	if hasField && field == "" {
+		writeError(w, r, http.StatusBadRequest, "A field must be provided after the key in the request path")
+		return
+	}
+
+	caller := identityFromContext(r.Context())
+	klog.Infof("Caller [%s] is sending a %s for hash [%s]", caller, r.Method, key)
+
+	op := operationWrite
+	if r.Method == "GET" {
+		op = operationRead
+	}
+	if !authorizeKey(w, r, op, key) {
+		return
+	}
+
+	switch {
+	case r.Method == "GET" && hasField:
+		getHashFieldHandler(w, r, key, field)
+	case r.Method == "GET":
+		getHashHandler(w, r, key)
+	case r.Method == "PUT" && hasField:
+		putHashFieldHandler(w, r, key, field)
+	case r.Method == "PUT":
+		putHashHandler(w, r, key)
+	case r.Method == "PATCH":
+		patchHashHandler(w, r, key)
+	case r.Method == "DELETE" && hasField:
+		deleteHashFieldHandler(w, r, key, field)
+	case r.Method == "DELETE":
+		deleteHashHandler(w, r, key)
+	}
+}
+
+// tell the caller the hash they asked for has no such field
+func writeFieldNotFound(w http.ResponseWriter, r *http.Request, key string, field string) {
+	writeProblem(w, r, Problem{
+		Type:   problemTypeFieldNotFound,
+		Title:  "Field not found",
+		Status: http.StatusNotFound,
+		Detail: fmt.Sprintf("Field [%s] of key [%s] not found", field, key),
+		Key:    key,
+		Field:  field,
+	})
+}
+
+// set fields of the hash at key. With no TTL from the caller a hash that
+// already exists keeps its expiry, and a new one gets our default.
+func updateHash(ctx context.Context, key string, fields map[string]string, ttl *int) (map[string]string, error) {
+	if ttl == nil {
+		return rdb.UpdateHash(ctx, key, fields, config.getDefaultTTL(), true)
+	}
+	return rdb.UpdateHash(ctx, key, fields, *ttl, false)
+}
+
+// check the fields a caller sent us and count them against their quota
+func checkHashFields(w http.ResponseWriter, r *http.Request, key string, fields map[string]string) bool {
+	if len(fields) == 0 {
+		writeDecodeError(w, r, &malformedRequest{status: http.StatusBadRequest, msg: "Request body must include at least one field", field: "fields"})
+		return false
+	}
+
+	n := len(key)
+	for field, value := range fields {
+		n += len(field) + len(value)
+	}
+	return consumeWriteQuota(w, r, n)
+}
+
+// return every field of the hash at key
+func getHashHandler(w http.ResponseWriter, r *http.Request, key string) {
+	ctx, cancel := readContext(r)
+	defer cancel()
+
+	fields, err := rdb.HGetAll(ctx, key)
+	if errors.Is(err, redisCache.ErrNil) {
+		writeNotFound(w, r, key)
+		return
+	}
+	if err != nil {
+		writeCacheError(w, r, ctx, err)
+		return
+	}
+
+	err = encodeJSONBody(w, HashResult{
+		Key:    key,
+		Fields: fields,
+	})
+	if err != nil {
+		writeInternalError(w, r, err)
+	}
+}
+
+// return one field of the hash at key
+func getHashFieldHandler(w http.ResponseWriter, r *http.Request, key string, field string) {
+	ctx, cancel := readContext(r)
+	defer cancel()
+
+	value, err := rdb.HGet(ctx, key, field)
+	if errors.Is(err, redisCache.ErrNil) {
+		writeFieldNotFound(w, r, key, field)
+		return
+	}
+	if err != nil {
+		writeCacheError(w, r, ctx, err)
+		return
+	}
+
+	err = encodeJSONBody(w, HashFieldResult{
+		Key:   key,
+		Field: field,
+		Value: value,
+	})
+	if err != nil {
+		writeInternalError(w, r, err)
+	}
+}
+
+// store a hash at key, replacing whatever was there
+func putHashHandler(w http.ResponseWriter, r *http.Request, key string) {
+	var m HashRequest
+	err := decodeJSONBody(w, r, &m)
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	if !checkHashFields(w, r, key, m.Fields) {
+		return
+	}
+
+	ttl := config.getDefaultTTL()
+	if m.TTL != nil {
+		ttl = *m.TTL
+	}
+
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	err = rdb.ReplaceHash(ctx, key, m.Fields, ttl)
+	if err != nil {
+		writeCacheError(w, r, ctx, err)
+		return
+	}
+
+	err = encodeJSONBody(w, HashResult{
+		Key:    key,
+		Fields: m.Fields,
+	})
+	if err != nil {
+		writeInternalError(w, r, err)
+	}
+}
+
+// set some fields of the hash at key, leaving the rest alone; the reply
+// is the whole hash as it is afterwards
+func patchHashHandler(w http.ResponseWriter, r *http.Request, key string) {
+	var m HashRequest
+	err := decodeJSONBody(w, r, &m)
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	if !checkHashFields(w, r, key, m.Fields) {
+		return
+	}
+
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	fields, err := updateHash(ctx, key, m.Fields, m.TTL)
+	if err != nil {
+		writeCacheError(w, r, ctx, err)
+		return
+	}
+
+	err = encodeJSONBody(w, HashResult{
+		Key:    key,
+		Fields: fields,
+	})
+	if err != nil {
+		writeInternalError(w, r, err)
+	}
+}
+
+// set one field of the hash at key
+func putHashFieldHandler(w http.ResponseWriter, r *http.Request, key string, field string) {
+	var m HashFieldRequest
+	err := decodeJSONBody(w, r, &m)
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	if !checkHashFields(w, r, key, map[string]string{field: m.Value}) {
+		return
+	}
+
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	_, err = updateHash(ctx, key, map[string]string{field: m.Value}, m.TTL)
+	if err != nil {
+		writeCacheError(w, r, ctx, err)
+		return
+	}
+
+	err = encodeJSONBody(w, HashFieldResult{
+		Key:   key,
+		Field: field,
+		Value: m.Value,
+	})
+	if err != nil {
+		writeInternalError(w, r, err)
+	}
+}
+
+// remove one field of the hash at key, returning a 404 if it wasn't there
+func deleteHashFieldHandler(w http.ResponseWriter, r *http.Request, key string, field string) {
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	deleted, err := rdb.HDel(ctx, key, field)
+	if err != nil {
+		writeCacheError(w, r, ctx, err)
+		return
+	}
+
+	if deleted == 0 {
+		writeFieldNotFound(w, r, key, field)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// remove the whole hash at key. Unlike DELETE /v1/keys/{key} this won't
+// touch a string or counter that happens to live at key; that's a 409.
+func deleteHashHandler(w http.ResponseWriter, r *http.Request, key string) {
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	deleted, err := rdb.DeleteHash(ctx, key)
+	if err != nil {
+		writeCacheError(w, r, ctx, err)
+		return
+	}
+
+	if deleted == 0 {
+		writeNotFound(w, r, key)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
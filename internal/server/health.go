@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// a single named check that makes up part of a probe; check returns nil
+// when everything is fine
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// a struct representing how one check went, as shown by ?verbose. The
+// last error sticks around after the check recovers, so someone looking
+// at a pod that's ready again can still see why it flapped.
+type CheckResult struct {
+	Name          string     `json:"name"`
+	Status        string     `json:"status"`
+	Latency       string     `json:"latency"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+}
+
+// a struct representing the verbose body of /livez and /readyz
+type ProbeResult struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// the last failure we saw per check, shared by every probe
+var (
+	lastErrorsMu sync.Mutex
+	lastErrors   = map[string]CheckResult{}
+)
+
+// liveness only tells Kubernetes whether the process itself is wedged,
+// so it must never look at Redis - a Redis blip would otherwise restart
+// every pod at once, which only makes the blip worse
+var livenessChecks = []healthCheck{
+	{name: "ping", check: func(ctx context.Context) error { return nil }},
+}
+
+// readiness decides whether we get traffic, which is where Redis belongs
+var readinessChecks = []healthCheck{
+	{name: "shutdown", check: checkNotShuttingDown},
+	{name: "cache-connected", check: checkCacheConnected},
+	{name: "cache", check: checkCache},
+}
+
+func checkNotShuttingDown(ctx context.Context) error {
+	if shuttingDown.Load() {
+		return errors.New("The server is shutting down")
+	}
+	return nil
+}
+
+func checkCacheConnected(ctx context.Context) error {
+	if !cacheReady.Load() {
+		return errors.New("Waiting for the cache backend to become available")
+	}
+	return nil
+}
+
+func checkCache(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, milliseconds(config.getReadyzTimeout()))
+	defer cancel()
+
+	_, err := rdb.Ping(ctx)
+	return err
+}
+
+// run every check in turn, recording failures as we go. The checks run
+// without the lock held; a stalled Redis ping on /readyz mustn't keep
+// /livez waiting, or the kubelet restarts a healthy pod.
+func runChecks(ctx context.Context, checks []healthCheck) ProbeResult {
+	probe := ProbeResult{
+		Status: "ok",
+	}
+
+	for _, hc := range checks {
+		start := time.Now()
+		err := hc.check(ctx)
+
+		lastErrorsMu.Lock()
+		result := lastErrors[hc.name]
+		result.Name = hc.name
+		result.Status = "ok"
+		result.Latency = time.Since(start).String()
+
+		if err != nil {
+			now := time.Now()
+			result.Status = "failed"
+			result.LastError = err.Error()
+			result.LastErrorTime = &now
+			probe.Status = "failed"
+			lastErrors[hc.name] = result
+		}
+		lastErrorsMu.Unlock()
+
+		probe.Checks = append(probe.Checks, result)
+	}
+
+	return probe
+}
+
+// build a handler for a probe out of a list of checks. Plain callers get
+// "ok" or a 503 problem naming the failed checks; ?verbose gets the
+// whole list as JSON, a bit like the Kubernetes apiserver's ?verbose
+func probeHandler(name string, checks []healthCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		klog.Infof("Handling a %s probe...", name)
+
+		probe := runChecks(r.Context(), checks)
+		status := http.StatusOK
+		if probe.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+
+		if _, verbose := r.URL.Query()["verbose"]; verbose {
+			resp, err := json.Marshal(probe)
+			if err != nil {
+				writeInternalError(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write(resp)
+			return
+		}
+
+		if status != http.StatusOK {
+			var failed []string
+			for _, c := range probe.Checks {
+				if c.Status != "ok" {
+					failed = append(failed, fmt.Sprintf("%s: %s", c.Name, c.LastError))
+				}
+			}
+			klog.Warningf("The %s probe failed: %s", name, strings.Join(failed, "; "))
+			writeError(w, r, status, fmt.Sprintf("The %s probe failed: %s", name, strings.Join(failed, "; ")))
+			return
+		}
+
+		w.Write([]byte("ok"))
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"strings"
+)
+
+// a struct describing who is on the other end of a request, as far as
+// we've been able to verify: either a client certificate that passed
+// verification against our CA bundle, or an API key we know about. Only
+// API keys carry scopes; a client certificate on its own proves who the
+// caller is, not what they may do.
+type identity struct {
+	Subject string   `json:"subject"`
+	SANs    []string `json:"sans,omitempty"`
+	Scopes  []string `json:"scopes,omitempty"`
+}
+
+// report whether the identity is actually there; handlers can call this
+// on the result of identityFromContext without checking for nil first
+func (id *identity) verified() bool {
+	return id != nil && id.Subject != ""
+}
+
+// report whether the caller was granted scope; admin is allowed
+// everything
+func (id *identity) hasScope(scope string) bool {
+	if !id.verified() {
+		return false
+	}
+	for _, s := range id.Scopes {
+		if s == scope || s == scopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// a short, log-friendly description of the caller
+func (id *identity) String() string {
+	if !id.verified() {
+		return "anonymous"
+	}
+	if len(id.SANs) == 0 {
+		return id.Subject
+	}
+	return id.Subject + " [" + strings.Join(id.SANs, ", ") + "]"
+}
+
+// an unexported type for our context keys, so nobody outside the package
+// can collide with (or overwrite) the values we store on a request
+type contextKey int
+
+const (
+	identityKey contextKey = iota
+	requestIDKey
+)
+
+// pull the verified caller identity back out of a request context; returns
+// nil when the caller didn't present a verified client certificate
+func identityFromContext(ctx context.Context) *identity {
+	id, _ := ctx.Value(identityKey).(*identity)
+	return id
+}
+
+// build an identity out of the leaf of the first verified chain. We only
+// look at VerifiedChains rather than PeerCertificates, because a client
+// certificate that wasn't verified against our CA tells us nothing.
+func identityFromCertificate(cert *x509.Certificate) *identity {
+	id := &identity{
+		Subject: cert.Subject.String(),
+	}
+
+	id.SANs = append(id.SANs, cert.DNSNames...)
+	id.SANs = append(id.SANs, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		id.SANs = append(id.SANs, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		id.SANs = append(id.SANs, uri.String())
+	}
+
+	return id
+}
+
+// a middleware that looks for a verified client certificate on the
+// request and, if there is one, stores the caller's identity in the
+// request context for the handlers further down the chain
+func withClientIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			id := identityFromCertificate(r.TLS.VerifiedChains[0][0])
+			r = r.WithContext(context.WithValue(r.Context(), identityKey, id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"k8s.io/klog"
+)
+
+// the signing algorithms we accept. Pinning the list keeps out "none"
+// and stops anyone passing off an HMAC of our public key as a signature.
+var jwtAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// a struct that checks bearer tokens from our SSO: the signature against
+// the identity provider's JWKS, then issuer, audience and expiry, and
+// finally turns the scope claim into our read/write/admin scopes
+type tokenValidator struct {
+	keys       keyfunc.Keyfunc
+	parser     *jwt.Parser
+	scopeClaim string
+	mapping    map[string][]string
+}
+
+// the tokens we accept; nil means JWT validation isn't configured
+var tokens *tokenValidator
+
+// parse server.jwt-scope-mapping, a list of claim-value=scope entries, e.g.
+// cache.readers=read. A claim value can map to more than one scope by
+// appearing more than once.
+func parseScopeMapping(entries []string) (map[string][]string, error) {
+	mapping := map[string][]string{}
+	for _, entry := range entries {
+		value, scope, ok := strings.Cut(entry, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("Invalid JWT scope mapping [%s], expected claim-value=scope", entry)
+		}
+		switch scope {
+		case scopeRead, scopeWrite, scopeAdmin:
+		default:
+			return nil, fmt.Errorf("Invalid JWT scope mapping [%s], supported scopes are [read write admin]", entry)
+		}
+		mapping[value] = append(mapping[value], scope)
+	}
+	return mapping, nil
+}
+
+// create the token validator from the configuration, or return nil if
+// neither a JWKS URL nor a JWKS file is configured. A JWKS URL is fetched
+// in the background and refreshed from then on, so an identity provider
+// that's down when we start doesn't stop us starting; the file is meant
+// for tests and offline development.
+func newTokenValidator(ctx context.Context) (*tokenValidator, error) {
+	var keys keyfunc.Keyfunc
+	var err error
+
+	switch {
+	case config.getJWTJWKSURL() != "":
+		keys, err = keyfunc.NewDefaultOverrideCtx(ctx, []string{config.getJWTJWKSURL()}, keyfunc.Override{
+			RefreshErrorHandlerFunc: func(u string) func(ctx context.Context, err error) {
+				return func(ctx context.Context, err error) {
+					klog.Errorf("Error refreshing JWKS from [%s]: %s", u, err.Error())
+				}
+			},
+		})
+	case config.getJWTJWKSFile() != "":
+		var raw []byte
+		raw, err = os.ReadFile(config.getJWTJWKSFile())
+		if err == nil {
+			keys, err = keyfunc.NewJWKSetJSON(raw)
+		}
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mapping, err := parseScopeMapping(config.getJWTScopeMapping())
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenValidator{
+		keys: keys,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods(jwtAlgorithms),
+			jwt.WithIssuer(config.getJWTIssuer()),
+			jwt.WithAudience(config.getJWTAudience()),
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+			jwt.WithLeeway(time.Duration(config.getJWTLeeway())*time.Second),
+		),
+		scopeClaim: config.getJWTScopeClaim(),
+		mapping:    mapping,
+	}, nil
+}
+
+// report whether a bearer token looks like a JWT rather than an API key;
+// a compact JWT is always three dot-separated parts
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// pull the values out of the scope claim. OAuth puts scopes in a single
+// space-separated string, while group and role claims are usually arrays,
+// so we take either.
+func claimValues(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// turn claim values into our scopes. Without a mapping, values that are
+// already called read, write or admin count as themselves.
+func (tv *tokenValidator) scopes(values []string) []string {
+	var scopes []string
+	for _, v := range values {
+		if len(tv.mapping) > 0 {
+			scopes = append(scopes, tv.mapping[v]...)
+			continue
+		}
+		switch v {
+		case scopeRead, scopeWrite, scopeAdmin:
+			scopes = append(scopes, v)
+		}
+	}
+	return scopes
+}
+
+// check a token and, if it's good, return the identity it carries
+func (tv *tokenValidator) validate(ctx context.Context, raw string) (*identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := tv.parser.ParseWithClaims(raw, claims, tv.keys.KeyfuncCtx(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, errors.New("Token has no subject")
+	}
+
+	// the email or username is what a person reading the logs will
+	// recognise, so keep it alongside the subject when there is one
+	id := &identity{
+		Subject: "jwt:" + subject,
+		Scopes:  tv.scopes(claimValues(claims, tv.scopeClaim)),
+	}
+	for _, name := range []string{"email", "preferred_username"} {
+		if v, ok := claims[name].(string); ok && v != "" {
+			id.SANs = append(id.SANs, v)
+		}
+	}
+
+	return id, nil
+}
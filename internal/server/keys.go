@@ -0,0 +1,196 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	redisCache "github.com/blomquistr/go-redis-example/v2/internal/cache"
+	"k8s.io/klog"
+)
+
+// the prefix our versioned key resource lives under; everything after
+// it in the path is the key itself
+const keysPath = "/v1/keys/"
+
+// a struct representing the body of a PUT to /v1/keys/{key}; the key
+// comes from the path, so all we need from the caller is the value and,
+// optionally, a TTL
+type PutKeyRequest struct {
+	Value string `json:"value"`
+	TTL   int    `json:"ttl"`
+}
+
+// a struct representing a key and its value, returned from GET and PUT
+type KeyResult struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// pull the key out of the request path, e.g. /v1/keys/foo returns foo
+func keyFromPath(path string) string {
+	return strings.TrimPrefix(path, keysPath)
+}
+
+// a single handler for the /v1/keys/{key} resource; it works out which
+// key the caller is after and then hands off to a handler per method
+func keysHandler(w http.ResponseWriter, r *http.Request) {
+	klog.Info("Handling a request for the keys resource...")
+
+	klog.Info("Checking request type...")
+	methods := []string{"GET", "HEAD", "PUT", "DELETE"}
+	err := checkSupportedMethod(methods, r.Method)
+	if err != nil {
+		writeMethodNotAllowed(w, r, methods, err)
+		return
+	}
+
+	key := keyFromPath(r.URL.Path)
+	if key == "" {
+		writeError(w, r, http.StatusBadRequest, "A key must be provided in the request path")
+		return
+	}
+
+	caller := identityFromContext(r.Context())
+	klog.Infof("Caller [%s] is sending a %s for key [%s]", caller, r.Method, key)
+
+	op := operationWrite
+	if r.Method == "GET" || r.Method == "HEAD" {
+		op = operationRead
+	}
+	if !authorizeKey(w, r, op, key) {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		getKeyHandler(w, r, key)
+	case "HEAD":
+		headKeyHandler(w, r, key)
+	case "PUT":
+		putKeyHandler(w, r, key)
+	case "DELETE":
+		deleteKeyHandler(w, r, key)
+	}
+}
+
+// return the value stored at key, or a 404 if there isn't one and
+// the caller didn't ask for a ?default= value instead
+func getKeyHandler(w http.ResponseWriter, r *http.Request, key string) {
+	ctx, cancel := readContext(r)
+	defer cancel()
+
+	result, err := rdb.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, redisCache.ErrNil) {
+			writeCacheError(w, r, ctx, err)
+			return
+		}
+
+		// the caller can give us a value to fall back on rather
+		// than a 404, so check for that before giving up
+		fallback, ok := defaultValue(r)
+		if !ok {
+			writeNotFound(w, r, key)
+			return
+		}
+		result = fallback
+	}
+
+	err = encodeJSONBody(w, KeyResult{
+		Key:   key,
+		Value: result,
+	})
+	if err != nil {
+		writeInternalError(w, r, err)
+	}
+}
+
+// tell the caller whether key exists without sending the value back
+func headKeyHandler(w http.ResponseWriter, r *http.Request, key string) {
+	ctx, cancel := readContext(r)
+	defer cancel()
+
+	// a HEAD response has no body, so all we can give the caller is
+	// the status code we'd have sent with a problem
+	exists, err := rdb.Exists(ctx, key)
+	if err != nil {
+		klog.Error(err.Error())
+		w.WriteHeader(cacheErrorStatus(r, ctx, err))
+		return
+	}
+
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// store a value at key, creating or replacing it
+func putKeyHandler(w http.ResponseWriter, r *http.Request, key string) {
+	// just like the legacy write endpoint, the TTL is optional and
+	// falls back to our configured default
+	m := PutKeyRequest{
+		TTL: config.getDefaultTTL(),
+	}
+
+	err := decodeJSONBody(w, r, &m)
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	if !consumeWriteQuota(w, r, len(key)+len(m.Value)) {
+		return
+	}
+
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	_, err = rdb.Set(ctx, key, m.Value, m.TTL)
+	if err != nil {
+		writeCacheError(w, r, ctx, err)
+		return
+	}
+
+	err = encodeJSONBody(w, KeyResult{
+		Key:   key,
+		Value: m.Value,
+	})
+	if err != nil {
+		writeInternalError(w, r, err)
+	}
+}
+
+// remove key, returning a 404 if there was nothing to remove
+func deleteKeyHandler(w http.ResponseWriter, r *http.Request, key string) {
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	deleted, err := rdb.Delete(ctx, key)
+	if err != nil {
+		writeCacheError(w, r, ctx, err)
+		return
+	}
+
+	if deleted == 0 {
+		writeNotFound(w, r, key)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// a middleware for the legacy /write-redis and /read-redis endpoints;
+// they keep working while callers migrate, but every response tells the
+// caller there's a newer API to move to
+func deprecated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("<%s{key}>; rel=\"successor-version\"", keysPath))
+		next(w, r)
+	}
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	redisCache "github.com/blomquistr/go-redis-example/v2/internal/cache"
+	"k8s.io/klog"
+)
+
+// the prefix our lock resource lives under; everything after it in the
+// path is the lock's name
+const locksPath = "/v1/locks/"
+
+// where locks live in Redis. The lock and its fencing counter are both
+// under our internal prefix, which authorizeKey keeps every other
+// endpoint out of, so nobody can reset a fencing token by writing to it.
+const lockKeyPrefix = internalKeyPrefix + "locks:"
+
+// the header a DELETE names the lock's owner in. The owner is what lets
+// someone release the lock, so it mustn't go in the query string, where
+// access logs, proxies and traces would all record it.
+const lockOwnerHeader = "X-Lock-Owner"
+
+// a struct representing the body of a POST or PATCH to /v1/locks/{name}.
+// On a POST the owner is optional and we make one up if it's missing; on
+// a PATCH it has to be the owner that acquired the lock. The TTL is in
+// seconds.
+type LockRequest struct {
+	Owner string `json:"owner"`
+	TTL   int    `json:"ttl"`
+}
+
+// a struct representing a lock we've handed out or extended. The owner
+// is needed to extend or release it, and the token should go along with
+// every write the lock protects.
+type LockResult struct {
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+	Token int64  `json:"token"`
+	TTL   int    `json:"ttl"`
+}
+
+// a single handler for the /v1/locks/{name} resource: POST acquires,
+// PATCH extends and DELETE releases
+func locksHandler(w http.ResponseWriter, r *http.Request) {
+	klog.Info("Handling a request for the locks resource...")
+
+	methods := []string{"POST", "PATCH", "DELETE"}
+	err := checkSupportedMethod(methods, r.Method)
+	if err != nil {
+		writeMethodNotAllowed(w, r, methods, err)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, locksPath)
+	if name == "" {
+		writeError(w, r, http.StatusBadRequest, "A lock name must be provided in the request path")
+		return
+	}
+
+	if !authorizeKey(w, r, operationWrite, name) {
+		return
+	}
+
+	// locks are only any use if every pod sees the same one
+	db, ok := rdb.(*redisCache.Database)
+	if !ok {
+		writeError(w, r, http.StatusNotImplemented, "Locks need the redis cache backend")
+		return
+	}
+
+	caller := identityFromContext(r.Context())
+	klog.Infof("Caller [%s] is sending a %s for lock [%s]", caller, r.Method, name)
+
+	switch r.Method {
+	case "POST":
+		acquireLockHandler(w, r, db, name)
+	case "PATCH":
+		extendLockHandler(w, r, db, name)
+	case "DELETE":
+		releaseLockHandler(w, r, db, name)
+	}
+}
+
+// decode a LockRequest, filling in the default TTL. The TTL is capped so
+// nobody can take what's effectively a permanent lock.
+func decodeLockRequest(w http.ResponseWriter, r *http.Request) (LockRequest, bool) {
+	m := LockRequest{
+		TTL: config.getLockDefaultTTL(),
+	}
+
+	err := decodeJSONBody(w, r, &m)
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return m, false
+	}
+
+	if m.TTL < 1 {
+		writeDecodeError(w, r, &malformedRequest{status: http.StatusBadRequest, msg: "The TTL must be at least 1 second", field: "ttl"})
+		return m, false
+	}
+	if m.TTL > config.getLockMaxTTL() {
+		writeDecodeError(w, r, &malformedRequest{status: http.StatusBadRequest, msg: fmt.Sprintf("The TTL must be at most %d seconds", config.getLockMaxTTL()), field: "ttl"})
+		return m, false
+	}
+
+	return m, true
+}
+
+// tell the caller they can't have a lock, or can't do what they asked
+// with it, because of who holds it
+func writeLockError(w http.ResponseWriter, r *http.Request, name string, err error) {
+	var held *redisCache.LockHeldError
+	switch {
+	case errors.As(err, &held):
+		w.Header().Set("Retry-After", headerSeconds(held.RetryAfter))
+		writeProblem(w, r, Problem{
+			Type:   problemTypeLockHeld,
+			Title:  "Lock held",
+			Status: http.StatusConflict,
+			Detail: fmt.Sprintf("Lock [%s] is held by another owner", name),
+			Key:    name,
+		})
+	case errors.Is(err, redisCache.ErrLockNotHeld):
+		writeProblem(w, r, Problem{
+			Type:   problemTypeLockNotHeld,
+			Title:  "Lock not held",
+			Status: http.StatusConflict,
+			Detail: fmt.Sprintf("Lock [%s] is held by another owner", name),
+			Key:    name,
+		})
+	case errors.Is(err, redisCache.ErrLockExpired):
+		writeProblem(w, r, Problem{
+			Type:   problemTypeLockNotHeld,
+			Title:  "Lock not held",
+			Status: http.StatusNotFound,
+			Detail: fmt.Sprintf("Lock [%s] isn't held by anyone; it may have expired", name),
+			Key:    name,
+		})
+	}
+}
+
+// report whether err is one of the ways a lock can be refused, as opposed
+// to something going wrong with Redis
+func isLockError(err error) bool {
+	var held *redisCache.LockHeldError
+	return errors.As(err, &held) || errors.Is(err, redisCache.ErrLockNotHeld) || errors.Is(err, redisCache.ErrLockExpired)
+}
+
+// take the lock, or answer 409 if someone else has it
+func acquireLockHandler(w http.ResponseWriter, r *http.Request, db *redisCache.Database, name string) {
+	m, ok := decodeLockRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// an owner the caller didn't pick just has to be unguessable, so
+	// nobody else can release the lock out from under them
+	if m.Owner == "" {
+		m.Owner = newRequestID()
+	}
+
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	lock := db.NewLock(lockKeyPrefix+name, m.Owner)
+	err := lock.Acquire(ctx, time.Duration(m.TTL)*time.Second)
+	if isLockError(err) {
+		writeLockError(w, r, name, err)
+		return
+	}
+	if err != nil {
+		writeCacheError(w, r, ctx, err)
+		return
+	}
+
+	err = encodeJSONBody(w, LockResult{
+		Name:  name,
+		Owner: m.Owner,
+		Token: lock.Token,
+		TTL:   m.TTL,
+	})
+	if err != nil {
+		writeInternalError(w, r, err)
+	}
+}
+
+// renew the lock for another TTL, if the caller still holds it
+func extendLockHandler(w http.ResponseWriter, r *http.Request, db *redisCache.Database, name string) {
+	m, ok := decodeLockRequest(w, r)
+	if !ok {
+		return
+	}
+	if m.Owner == "" {
+		writeDecodeError(w, r, &malformedRequest{status: http.StatusBadRequest, msg: "Request body must include the lock's owner", field: "owner"})
+		return
+	}
+
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	lock := db.NewLock(lockKeyPrefix+name, m.Owner)
+	err := lock.Extend(ctx, time.Duration(m.TTL)*time.Second)
+	if isLockError(err) {
+		writeLockError(w, r, name, err)
+		return
+	}
+	if err != nil {
+		writeCacheError(w, r, ctx, err)
+		return
+	}
+
+	err = encodeJSONBody(w, LockResult{
+		Name:  name,
+		Owner: m.Owner,
+		Token: lock.Token,
+		TTL:   m.TTL,
+	})
+	if err != nil {
+		writeInternalError(w, r, err)
+	}
+}
+
+// give the lock up, if the caller holds it. The owner comes in the
+// X-Lock-Owner header or, as for a PATCH, in a JSON body.
+func releaseLockHandler(w http.ResponseWriter, r *http.Request, db *redisCache.Database, name string) {
+	owner := r.Header.Get(lockOwnerHeader)
+	if owner == "" && r.ContentLength != 0 {
+		var m LockRequest
+		err := decodeJSONBody(w, r, &m)
+		if err != nil {
+			writeDecodeError(w, r, err)
+			return
+		}
+		owner = m.Owner
+	}
+	if owner == "" {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("The lock's owner must be provided in the %s header or the request body", lockOwnerHeader))
+		return
+	}
+
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	err := db.NewLock(lockKeyPrefix+name, owner).Release(ctx)
+	if isLockError(err) {
+		writeLockError(w, r, name, err)
+		return
+	}
+	if err != nil {
+		writeCacheError(w, r, ctx, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "redistester",
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests handled, by route, method and status code.",
+		},
+		[]string{"route", "method", "code"},
+	)
+
+	httpDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "redistester",
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of HTTP requests, by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"route", "method", "code"},
+	)
+
+	httpInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "redistester",
+			Subsystem: "http",
+			Name:      "requests_in_flight",
+			Help:      "HTTP requests currently being handled, by route.",
+		},
+		[]string{"route"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(httpRequests, httpDuration, httpInFlight)
+}
+
+// wrap a handler so its requests are counted and timed under route. We
+// label by the route we registered rather than the request path, or every
+// key under /v1/keys/ would become its own time series.
+func instrumentHandler(route string, handler http.Handler) http.Handler {
+	labels := prometheus.Labels{"route": route}
+
+	return promhttp.InstrumentHandlerInFlight(httpInFlight.With(labels),
+		promhttp.InstrumentHandlerDuration(httpDuration.MustCurryWith(labels),
+			promhttp.InstrumentHandlerCounter(httpRequests.MustCurryWith(labels), handler),
+		),
+	)
+}
+
+// register a handler on our mux with tracing and metrics wrapped around
+// it; Run uses this instead of http.HandleFunc so no route goes unmeasured
+func handleFunc(route string, handler http.HandlerFunc) {
+	http.Handle(route, traceHandler(route, instrumentHandler(route, handler)))
+}
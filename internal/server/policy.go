@@ -0,0 +1,149 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"k8s.io/klog"
+)
+
+// the operations a key policy rule can allow
+const (
+	operationRead  = "read"
+	operationWrite = "write"
+)
+
+// a struct representing one rule in the key policy: the callers it
+// applies to, the keys it covers and what those callers may do with them.
+// Callers are matched against the caller's subject (api-key:team-a,
+// jwt:1234) or any of their other names, like an email address; "*"
+// matches any authenticated caller and "anonymous" everyone else. Keys
+// are matched exactly, or by prefix when the pattern ends in "*".
+type PolicyRule struct {
+	Callers    []string `json:"callers"`
+	Keys       []string `json:"keys"`
+	Operations []string `json:"operations"`
+}
+
+// a struct representing the key policy file, e.g.
+//
+//	{"rules": [
+//	  {"callers": ["api-key:team-a"], "keys": ["team-a:*"], "operations": ["read", "write"]},
+//	  {"callers": ["*"], "keys": ["shared:*"], "operations": ["read"]}
+//	]}
+type KeyPolicy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// the policy every key operation is checked against; nil means there's
+// no policy and any caller who got past authentication can touch any key
+var keyPolicy *KeyPolicy
+
+// load the key policy file, or return nil if there isn't one configured
+func loadKeyPolicy(file string) (*KeyPolicy, error) {
+	if file == "" {
+		return nil, nil
+	}
+
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var p KeyPolicy
+	if err := json.Unmarshal(contents, &p); err != nil {
+		return nil, fmt.Errorf("Error parsing key policy file [%s]: %w", file, err)
+	}
+
+	for i, rule := range p.Rules {
+		for _, op := range rule.Operations {
+			if op != operationRead && op != operationWrite {
+				return nil, fmt.Errorf("Key policy rule %d has invalid operation [%s], supported operations are [read write]", i, op)
+			}
+		}
+	}
+
+	klog.Infof("Loaded key policy with %d rules", len(p.Rules))
+	return &p, nil
+}
+
+// report whether pattern matches key, either exactly or as a prefix
+func keyMatches(pattern string, key string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(key, prefix)
+	}
+	return pattern == key
+}
+
+// report whether a rule applies to the caller
+func (rule PolicyRule) appliesTo(id *identity) bool {
+	for _, c := range rule.Callers {
+		switch {
+		case !id.verified():
+			if c == "anonymous" {
+				return true
+			}
+		case c == "*" || c == id.Subject:
+			return true
+		default:
+			for _, name := range id.SANs {
+				if c == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// report whether the policy lets the caller perform op on key. Rules only
+// ever allow, so the first match wins and anything unmatched is denied.
+func (p *KeyPolicy) allows(id *identity, op string, key string) bool {
+	for _, rule := range p.Rules {
+		if !rule.appliesTo(id) {
+			continue
+		}
+		for _, pattern := range rule.Keys {
+			if !keyMatches(pattern, key) {
+				continue
+			}
+			for _, allowed := range rule.Operations {
+				if allowed == op {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// the prefix of every key the server keeps its own state under, such as
+// rate limits, quotas and locks. Callers must never be able to write
+// these, or they could reset their own limits or a lock's fencing token.
+const internalKeyPrefix = "redistester:"
+
+// report whether key is, or hash tags itself into, our internal keyspace
+func reservedKey(key string) bool {
+	return strings.HasPrefix(key, internalKeyPrefix) || strings.HasPrefix(key, "{"+internalKeyPrefix)
+}
+
+// check the caller may perform op on key, answering 403 and leaving an
+// audit trail if not. Every handler that touches a key calls this before
+// going anywhere near the cache, and stops if it returns false. Callers
+// with the admin scope can touch every key but our own internal ones,
+// which nobody can reach through the API, policy or no policy.
+func authorizeKey(w http.ResponseWriter, r *http.Request, op string, key string) bool {
+	id := identityFromContext(r.Context())
+	reserved := reservedKey(key)
+	if !reserved && (keyPolicy == nil || id.hasScope(scopeAdmin) || keyPolicy.allows(id, op, key)) {
+		return true
+	}
+
+	klog.Warningf("AUDIT denied caller=[%s] operation=[%s] key=[%s] method=[%s] path=[%s] request_id=[%s]",
+		id, op, key, r.Method, r.URL.Path, requestIDFromContext(r.Context()))
+	writeError(w, r, http.StatusForbidden, fmt.Sprintf("Not allowed to %s key [%s]", op, key))
+	return false
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"k8s.io/klog"
+)
+
+// the media type for RFC 7807 problem details
+const problemContentType = "application/problem+json"
+
+// the problem types we send back. Anything without a more specific type
+// uses about:blank, which per RFC 7807 means the title is just the HTTP
+// status text.
+const (
+	problemTypeBlank            = "about:blank"
+	problemTypeMalformedRequest = "/problems/malformed-request"
+	problemTypeKeyNotFound      = "/problems/key-not-found"
+	problemTypeInternal         = "/problems/internal-error"
+	problemTypeCacheTimeout     = "/problems/cache-timeout"
+	problemTypeRateLimited      = "/problems/rate-limited"
+	problemTypeQuotaExceeded    = "/problems/quota-exceeded"
+	problemTypeLockHeld         = "/problems/lock-held"
+	problemTypeLockNotHeld      = "/problems/lock-not-held"
+	problemTypeNotANumber       = "/problems/not-a-number"
+	problemTypeCounterOverflow  = "/problems/counter-overflow"
+	problemTypeFieldNotFound    = "/problems/field-not-found"
+	problemTypeWrongType        = "/problems/wrong-type"
+)
+
+// a struct representing an RFC 7807 problem details object. Every error
+// we send back to a caller is one of these, so clients only ever have to
+// parse one shape of error.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Field     string `json:"field,omitempty"`
+	Key       string `json:"key,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// write a problem to the caller; the request fills in the instance and
+// request ID so a caller can quote them back to us when something breaks
+func writeProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	if p.Type == "" {
+		p.Type = problemTypeBlank
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	p.Instance = r.URL.Path
+	p.RequestID = requestIDFromContext(r.Context())
+
+	resp, err := json.Marshal(p)
+	if err != nil {
+		// this really shouldn't happen, as Problem is nothing but strings
+		// and an int, but we still owe the caller a status code
+		klog.Errorf("Error encoding problem details: %s", err.Error())
+		w.WriteHeader(p.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	w.Write(resp)
+}
+
+// a shortcut for the common case of a status code and a message
+func writeError(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	writeProblem(w, r, Problem{
+		Status: status,
+		Detail: detail,
+	})
+}
+
+// send a 405, along with the Allow header telling the caller which
+// methods they could have used instead
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request, methods []string, err error) {
+	for _, m := range methods {
+		w.Header().Add("Allow", m)
+	}
+	writeError(w, r, http.StatusMethodNotAllowed, err.Error())
+}
+
+// tell the caller the key they asked for doesn't exist
+func writeNotFound(w http.ResponseWriter, r *http.Request, key string) {
+	writeProblem(w, r, Problem{
+		Type:   problemTypeKeyNotFound,
+		Title:  "Key not found",
+		Status: http.StatusNotFound,
+		Detail: fmt.Sprintf("Key [%s] not found", key),
+		Key:    key,
+	})
+}
+
+// something went wrong on our side. The real error goes to the log,
+// tagged with the request ID; the caller only gets the request ID, so
+// we never leak Redis addresses or error strings out of the server
+func writeInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	requestID := requestIDFromContext(r.Context())
+	klog.Errorf("Internal error handling request [%s]: %s", requestID, err.Error())
+
+	writeProblem(w, r, Problem{
+		Type:   problemTypeInternal,
+		Status: http.StatusInternalServerError,
+		Detail: "An internal error occurred; quote the request ID when reporting it",
+	})
+}
+
+// turn an error from decodeJSONBody into a problem; malformedRequest
+// errors are the caller's fault and safe to show them, anything else is
+// ours and gets sanitized
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var mr *malformedRequest
+	if !errors.As(err, &mr) {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	writeProblem(w, r, Problem{
+		Type:   problemTypeMalformedRequest,
+		Title:  "Malformed request body",
+		Status: mr.status,
+		Detail: mr.msg,
+		Field:  mr.field,
+	})
+}
+
+// the header we read request IDs from and echo them back in
+const requestIDHeader = "X-Request-ID"
+
+// pull the request ID back out of a request context
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// make up a new random request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// a middleware that gives every request an ID, reusing the caller's
+// X-Request-ID if they sent one so a request can be followed through
+// a proxy and into our logs
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey, id))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	redisCache "github.com/blomquistr/go-redis-example/v2/internal/cache"
+	"k8s.io/klog"
+)
+
+// where limiter state lives in Redis; authorizeKey keeps callers out of
+// it, so nobody can reset their own limits
+const limiterKeyPrefix = internalKeyPrefix + "limits:"
+
+// the route in server.rate-limits that applies to routes without their own
+const defaultRateLimitRoute = "*"
+
+var (
+	// where we keep rate limits and quotas; nil when both are turned off
+	limiter redisCache.Limiter
+	// the token bucket for each route, from server.rate-limits
+	rateLimits map[string]redisCache.Bucket
+)
+
+// parse server.rate-limits, a list of route=rate:burst entries where rate
+// is requests per second, e.g. /write-redis=5:10 or *=100:200
+func parseRateLimits(entries []string) (map[string]redisCache.Bucket, error) {
+	limits := map[string]redisCache.Bucket{}
+	for _, entry := range entries {
+		route, spec, ok := strings.Cut(entry, "=")
+		rate, burst, ok2 := strings.Cut(spec, ":")
+		if !ok || !ok2 || route == "" {
+			return nil, fmt.Errorf("Invalid rate limit [%s], expected route=rate:burst", entry)
+		}
+
+		r, err := strconv.ParseFloat(rate, 64)
+		if err != nil || r <= 0 {
+			return nil, fmt.Errorf("Invalid rate limit [%s], the rate must be a positive number", entry)
+		}
+		b, err := strconv.ParseInt(burst, 10, 64)
+		if err != nil || b < 1 {
+			return nil, fmt.Errorf("Invalid rate limit [%s], the burst must be at least 1", entry)
+		}
+
+		limits[route] = redisCache.Bucket{Rate: r, Burst: b}
+	}
+	return limits, nil
+}
+
+// build the limiter selected by server.rate-limit-backend
+func newLimiter() (redisCache.Limiter, error) {
+	switch config.getRateLimitBackend() {
+	case "none":
+		return nil, nil
+	case "memory":
+		return redisCache.NewMemoryLimiter(), nil
+	case "redis":
+		db, ok := rdb.(*redisCache.Database)
+		if !ok {
+			return nil, fmt.Errorf("The redis rate limit backend needs the redis cache backend")
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("Invalid rate limit backend [%s], supported backends are [none memory redis]", config.getRateLimitBackend())
+	}
+}
+
+// who a limit applies to: the authenticated caller if we know who they
+// are, otherwise the address they're calling from
+func clientKey(r *http.Request) string {
+	if id := identityFromContext(r.Context()); id.verified() {
+		return id.Subject
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// whole seconds for a header, rounding up so a caller who waits that long
+// is never told to wait again
+func headerSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// a middleware applying the token bucket configured for route, per
+// client. It sits inside requireScope, so it can tell callers apart by
+// identity. If the limiter itself fails we let the request through; a
+// Redis blip shouldn't turn into an outage of its own.
+func rateLimited(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bucket, ok := rateLimits[route]
+		if !ok {
+			bucket, ok = rateLimits[defaultRateLimitRoute]
+		}
+		if limiter == nil || !ok {
+			next(w, r)
+			return
+		}
+
+		client := clientKey(r)
+		ctx, cancel := writeContext(r)
+		defer cancel()
+
+		result, err := limiter.TakeToken(ctx, limiterKeyPrefix+"rate:"+client+":"+route, bucket)
+		if err != nil {
+			klog.Errorf("Error checking the rate limit for [%s], letting the request through: %s", client, err.Error())
+			next(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.FormatInt(bucket.Burst, 10))
+		w.Header().Set("RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+		w.Header().Set("RateLimit-Reset", headerSeconds(result.ResetAfter))
+
+		if !result.Allowed {
+			klog.Warningf("Rate limited caller [%s] on [%s]", client, route)
+			w.Header().Set("Retry-After", headerSeconds(result.RetryAfter))
+			writeProblem(w, r, Problem{
+				Type:   problemTypeRateLimited,
+				Title:  "Rate limited",
+				Status: http.StatusTooManyRequests,
+				Detail: fmt.Sprintf("Too many requests to [%s], slow down", route),
+			})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// how long until the current UTC day ends, when daily quotas reset
+func untilEndOfDay(now time.Time) time.Duration {
+	now = now.UTC()
+	return now.Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+}
+
+// count n bytes against the caller's daily write quota, answering 429 if
+// they don't fit. Write handlers call this just before writing, and stop
+// if it returns false. Like rate limits, a failing limiter lets the
+// write through.
+func consumeWriteQuota(w http.ResponseWriter, r *http.Request, n int) bool {
+	quota := int64(config.getWriteQuotaBytes())
+	if limiter == nil || quota == 0 {
+		return true
+	}
+
+	client := clientKey(r)
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	now := time.Now().UTC()
+	key := limiterKeyPrefix + "quota:" + client + ":" + now.Format("2006-01-02")
+	result, err := limiter.ConsumeQuota(ctx, key, int64(n), quota, untilEndOfDay(now))
+	if err != nil {
+		klog.Errorf("Error checking the write quota for [%s], letting the write through: %s", client, err.Error())
+		return true
+	}
+
+	if !result.Allowed {
+		klog.Warningf("Caller [%s] is over their daily write quota, %d of %d bytes used", client, result.Used, quota)
+		w.Header().Set("Retry-After", headerSeconds(result.ResetAfter))
+		writeProblem(w, r, Problem{
+			Type:   problemTypeQuotaExceeded,
+			Title:  "Quota exceeded",
+			Status: http.StatusTooManyRequests,
+			Detail: fmt.Sprintf("Writing %d bytes would take you over your daily quota of %d bytes; %d bytes are left", n, quota, result.Remaining),
+		})
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	redisCache "github.com/blomquistr/go-redis-example/v2/internal/cache"
+	"k8s.io/klog"
+)
+
+// the prefix other services ask rate limit questions under; everything
+// after it is the name of the action being limited
+const ratelimitPath = "/v1/ratelimit/"
+
+// a struct representing the body of a POST to /v1/ratelimit/{name}: who
+// wants to do the action, and the limit they're held to. The period is
+// in seconds, and can be fractional.
+type RateLimitRequest struct {
+	Client    string  `json:"client"`
+	Limit     int64   `json:"limit"`
+	Period    float64 `json:"period"`
+	Algorithm string  `json:"algorithm"`
+	Cost      int64   `json:"cost"`
+}
+
+// a struct representing our answer; the durations are in milliseconds
+type RateLimitResponse struct {
+	Name         string `json:"name"`
+	Client       string `json:"client"`
+	Allowed      bool   `json:"allowed"`
+	Limit        int64  `json:"limit"`
+	Remaining    int64  `json:"remaining"`
+	ResetMs      int64  `json:"resetMs"`
+	RetryAfterMs int64  `json:"retryAfterMs,omitempty"`
+}
+
+// answer "may this client do this action now?" for other services, so
+// they don't each build their own limiter on top of the cache. A refusal
+// is still a 200; the caller asked a question and allowed is the answer.
+func ratelimitHandler(w http.ResponseWriter, r *http.Request) {
+	klog.Info("Handling a rate limit check...")
+
+	methods := []string{"POST"}
+	err := checkSupportedMethod(methods, r.Method)
+	if err != nil {
+		writeMethodNotAllowed(w, r, methods, err)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, ratelimitPath)
+	if name == "" {
+		writeError(w, r, http.StatusBadRequest, "A rate limit name must be provided in the request path")
+		return
+	}
+
+	if !authorizeKey(w, r, operationWrite, name) {
+		return
+	}
+
+	m := RateLimitRequest{
+		Algorithm: redisCache.AlgorithmGCRA,
+		Cost:      1,
+	}
+	err = decodeJSONBody(w, r, &m)
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	switch {
+	case m.Client == "":
+		writeDecodeError(w, r, &malformedRequest{status: http.StatusBadRequest, msg: "Request body must include a client", field: "client"})
+		return
+	case m.Limit < 1:
+		writeDecodeError(w, r, &malformedRequest{status: http.StatusBadRequest, msg: "The limit must be at least 1", field: "limit"})
+		return
+	case m.Period < 0.001:
+		writeDecodeError(w, r, &malformedRequest{status: http.StatusBadRequest, msg: "The period must be at least 0.001 seconds", field: "period"})
+		return
+	// a period this long would overflow a time.Duration, and even short of
+	// that, a window of years is a typo rather than a rate limit
+	case m.Period > float64(config.getRateLimitMaxPeriod()):
+		writeDecodeError(w, r, &malformedRequest{status: http.StatusBadRequest, msg: fmt.Sprintf("The period must be at most %d seconds", config.getRateLimitMaxPeriod()), field: "period"})
+		return
+	case m.Limit > int64(config.getRateLimitMaxLimit()):
+		writeDecodeError(w, r, &malformedRequest{status: http.StatusBadRequest, msg: fmt.Sprintf("The limit must be at most %d", config.getRateLimitMaxLimit()), field: "limit"})
+		return
+	case m.Cost < 1:
+		writeDecodeError(w, r, &malformedRequest{status: http.StatusBadRequest, msg: "The cost must be at least 1", field: "cost"})
+		return
+	// a request costing more than the limit could never be allowed
+	case m.Cost > m.Limit:
+		writeDecodeError(w, r, &malformedRequest{status: http.StatusBadRequest, msg: "The cost must not be more than the limit", field: "cost"})
+		return
+	}
+
+	// the limiter's scripts need Redis; there's nothing to share limits
+	// through in the in-memory backend
+	db, ok := rdb.(*redisCache.Database)
+	if !ok {
+		writeError(w, r, http.StatusNotImplemented, "Rate limit checks need the redis cache backend")
+		return
+	}
+
+	rl, err := redisCache.NewRateLimiter(db, m.Algorithm)
+	if err != nil {
+		writeDecodeError(w, r, &malformedRequest{status: http.StatusBadRequest, msg: err.Error(), field: "algorithm"})
+		return
+	}
+
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	// the algorithms keep different kinds of state, so each gets its own key
+	key := fmt.Sprintf("%sapi:%s:%s:%s", limiterKeyPrefix, m.Algorithm, name, m.Client)
+	limit := redisCache.RateLimit{
+		Limit:  m.Limit,
+		Period: time.Duration(m.Period * float64(time.Second)),
+	}
+	result, err := rl.AllowN(ctx, key, limit, m.Cost)
+	if err != nil {
+		writeCacheError(w, r, ctx, err)
+		return
+	}
+
+	w.Header().Set("RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+	w.Header().Set("RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+	w.Header().Set("RateLimit-Reset", headerSeconds(result.ResetAfter))
+
+	err = encodeJSONBody(w, RateLimitResponse{
+		Name:         name,
+		Client:       m.Client,
+		Allowed:      result.Allowed,
+		Limit:        result.Limit,
+		Remaining:    result.Remaining,
+		ResetMs:      result.ResetAfter.Milliseconds(),
+		RetryAfterMs: result.RetryAfter.Milliseconds(),
+	})
+	if err != nil {
+		writeInternalError(w, r, err)
+	}
+}
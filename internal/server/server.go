@@ -5,49 +5,39 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	redisCache "github.com/blomquistr/go-redis-example/v2/internal/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/redis/go-redis/v9"
 	"k8s.io/klog"
 )
 
 var (
-	ctx    context.Context = context.TODO()
-	rdb    *redisCache.Database
+	rdb    redisCache.Store
 	config IConfig
 )
 
 // function to ping the Redis cache and return a response
 func pingHandler(w http.ResponseWriter, r *http.Request) {
 	klog.Info("Handling a ping...")
-	result, err := rdb.Ping()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	klog.Info(fmt.Sprintf("Received response [%s] from Redis", result))
-	w.Write([]byte(result))
-}
+	ctx, cancel := readContext(r)
+	defer cancel()
 
-// function to wrap a readiness probe around - will not return 200 unless Redis is available
-func readyzHandler(w http.ResponseWriter, r *http.Request) {
-	klog.Info("Handling a readiness probe...")
-	result, err := rdb.Ping()
+	result, err := rdb.Ping(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeCacheError(w, r, ctx, err)
 		return
 	}
 	klog.Info(fmt.Sprintf("Received response [%s] from Redis", result))
 	w.Write([]byte(result))
 }
 
-// function to dump some debugging information - keep tacking on more debug info later
-func debugHandler(w http.ResponseWriter, r *http.Request) {
-	klog.Info("Dumping debug information...")
-	w.Write([]byte(fmt.Sprintf("Configuration:\n==========\n[%+v]\n", config)))
-	w.Write([]byte(fmt.Sprintf("Variables:\n==========\ncontext: [%+v]\n==========\nrdb: [%+v]\n==========\n", ctx, rdb)))
-}
-
 // a wrapper function to validate we're getting the right method
 // from the caller; takes two parameters, a list of supported
 // methods and the method from the caller. If the method from the
@@ -78,7 +68,8 @@ type WriteRequest struct {
 
 // make a Redis database entry
 func makeWorkHandler(w http.ResponseWriter, r *http.Request) {
-	klog.Info("Making some work in Redis...")
+	caller := identityFromContext(r.Context())
+	klog.Infof("Making some work in Redis for caller [%s]...", caller)
 
 	// check to make sure we have the right request method, and
 	// if not return that information to the caller to re-submit
@@ -87,7 +78,7 @@ func makeWorkHandler(w http.ResponseWriter, r *http.Request) {
 	methods := []string{"PUT", "POST"}
 	err := checkSupportedMethod(methods, r.Method)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r, methods, err)
 		return
 	}
 
@@ -100,7 +91,7 @@ func makeWorkHandler(w http.ResponseWriter, r *http.Request) {
 		klog.Info("Processing PUT request to update existing cache entry")
 	default:
 		msg := fmt.Sprintf("Invalid request method [%s], supported methods are [%s]", r.Method, "PUT, POST")
-		http.Error(w, msg, http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r, methods, errors.New(msg))
 		return
 	}
 
@@ -120,24 +111,30 @@ func makeWorkHandler(w http.ResponseWriter, r *http.Request) {
 	// the errors that handler bubbles up in a more condensed way in our request
 	// handler method.
 	if err != nil {
-		var mr *malformedRequest
-		if errors.As(err, &mr) {
-			http.Error(w, mr.msg, mr.status)
-		} else {
-			klog.Error(err.Error())
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		}
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	if !authorizeKey(w, r, operationWrite, m.Key) {
+		return
+	}
+	if !consumeWriteQuota(w, r, len(m.Key)+len(m.Value)) {
 		return
 	}
 
 	// do something here to write to Redis
-	klog.Info(fmt.Sprintf("Writing request [%v] value to Redis...", m))
-	resp, err := rdb.Set(m.Key, m.Value, m.TTL)
+	klog.Info(fmt.Sprintf("Writing request [%v] value to Redis for caller [%s]...", m, caller))
+	ctx, cancel := writeContext(r)
+	defer cancel()
+
+	resp, err := rdb.Set(ctx, m.Key, m.Value, m.TTL)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeCacheError(w, r, ctx, err)
 		return
 	}
 
+	klog.Infof("Caller [%s] wrote key [%s]", caller, m.Key)
+
 	// write the response back to the caller; this will provide a status code
 	klog.Info("Responding to the caller...")
 	w.Write([]byte(resp))
@@ -153,13 +150,14 @@ type ReadResult struct {
 
 // read an entry from the database
 func readCacheHandler(w http.ResponseWriter, r *http.Request) {
-	klog.Info("Reading something from the Redis cache...")
+	caller := identityFromContext(r.Context())
+	klog.Infof("Reading something from the Redis cache for caller [%s]...", caller)
 
 	klog.Info("Checking request type...")
 	methods := []string{"GET"}
 	err := checkSupportedMethod(methods, r.Method)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r, methods, err)
 		return
 	}
 
@@ -168,7 +166,7 @@ func readCacheHandler(w http.ResponseWriter, r *http.Request) {
 		klog.Info("Processing GET request to retrieve a cache entry")
 	default:
 		msg := fmt.Sprintf("Invalid request method [%s], supported methods are [%s]", r.Method, "GET")
-		http.Error(w, msg, http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, r, methods, errors.New(msg))
 		return
 	}
 
@@ -186,27 +184,35 @@ func readCacheHandler(w http.ResponseWriter, r *http.Request) {
 	// the errors that handler bubbles up in a more condensed way in our request
 	// handler method.
 	if err != nil {
-		var mr *malformedRequest
-		if errors.As(err, &mr) {
-			http.Error(w, mr.msg, mr.status)
-		} else {
-			klog.Error(err.Error())
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		}
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	if !authorizeKey(w, r, operationRead, m.Key) {
 		return
 	}
 
 	// now we have a key, lets read it from the Redis database
-	result, err := rdb.Get(m.Key)
+	klog.Infof("Caller [%s] is reading key [%s]", caller, m.Key)
+	ctx, cancel := readContext(r)
+	defer cancel()
+
+	result, err := rdb.Get(ctx, m.Key)
 	if err != nil {
-		klog.Error(fmt.Sprintf("Found result [%s]", result))
 		klog.Error(fmt.Sprintf("Received error response [%s]", err.Error()))
-		if result == "" && err.Error() == "redis: nil" {
-			result = "nil"
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if !errors.Is(err, redisCache.ErrNil) {
+			writeCacheError(w, r, ctx, err)
+			return
+		}
+
+		// a missing key is a 404, unless the caller gave us a
+		// ?default= value to hand back instead
+		fallback, ok := defaultValue(r)
+		if !ok {
+			writeNotFound(w, r, m.Key)
 			return
 		}
+		result = fallback
 	}
 
 	klog.Info(fmt.Sprintf("Found result [%s]", result))
@@ -221,8 +227,120 @@ func readCacheHandler(w http.ResponseWriter, r *http.Request) {
 
 	// whoops, invalid JSON, better write an error to the stream!
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, err)
+	}
+}
+
+// turn one of our millisecond config values into a time.Duration. The
+// -1 that go-redis uses to mean "no timeout" has to stay -1 rather than
+// become -1ms, which go-redis would treat as a real (and very short) one.
+func milliseconds(ms int) time.Duration {
+	if ms < 0 {
+		return time.Duration(ms)
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// a copy of the Redis options that's safe to log
+func redactOptions(opts redis.UniversalOptions) redis.UniversalOptions {
+	if opts.Password != "" {
+		opts.Password = redacted
+	}
+	if opts.SentinelPassword != "" {
+		opts.SentinelPassword = redacted
+	}
+	return opts
+}
+
+// build the cache backend selected by server.cache-backend
+func newStore() (redisCache.Store, error) {
+	switch config.getCacheBackend() {
+	case "memory":
+		klog.Warning("Using the in-memory cache backend; data is not shared between replicas and is lost on restart")
+		return redisCache.NewMemoryStore(), nil
+	case "redis":
+		tlsConfig, err := newRedisTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		// without ContextTimeoutEnabled go-redis ignores the deadlines on
+		// the contexts we pass it and only uses its own socket timeouts
+		opts := redis.UniversalOptions{
+			Addrs:                 []string{fmt.Sprintf("%s:%d", config.getRedisAddress(), config.getRedisPort())},
+			Username:              config.getRedisUsername(),
+			Password:              config.getRedisPassword(),
+			DB:                    config.getRedisDB(),
+			ContextTimeoutEnabled: true,
+			TLSConfig:             tlsConfig,
+
+			PoolSize:        config.getRedisPoolSize(),
+			MinIdleConns:    config.getRedisMinIdleConns(),
+			PoolTimeout:     milliseconds(config.getRedisPoolTimeout()),
+			DialTimeout:     milliseconds(config.getRedisDialTimeout()),
+			ReadTimeout:     milliseconds(config.getRedisReadTimeout()),
+			WriteTimeout:    milliseconds(config.getRedisWriteTimeout()),
+			MaxRetries:      config.getRedisMaxRetries(),
+			MinRetryBackoff: milliseconds(config.getRedisMinRetryBackoff()),
+			MaxRetryBackoff: milliseconds(config.getRedisMaxRetryBackoff()),
+		}
+
+		// with Sentinel we don't connect to a fixed address; instead we
+		// ask the sentinels where the master is and follow it around. A
+		// cluster starts from a list of seed nodes instead of one server
+		switch config.getRedisMode() {
+		case redisCache.ModeSentinel:
+			opts.Addrs = config.getRedisSentinelAddresses()
+			opts.MasterName = config.getRedisMasterName()
+			opts.SentinelPassword = config.getRedisSentinelPassword()
+		case redisCache.ModeCluster:
+			// fall back on redis-address and redis-port as the only seed
+			if len(config.getRedisAddresses()) > 0 {
+				opts.Addrs = config.getRedisAddresses()
+			}
+		}
+
+		db, err := redisCache.NewRedisDatabase(config.getRedisMode(), &opts)
+		if err != nil {
+			klog.Errorf("Redis options:\n==========\n[%+v]\n", redactOptions(opts))
+			return nil, err
+		}
+		if tracerProvider != nil {
+			db.EnableTracing(config.getTracingHashKeys())
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("Invalid cache backend [%s], supported backends are [redis memory]", config.getCacheBackend())
+	}
+}
+
+// flipped to true once the cache backend has answered a ping for the
+// first time; until then the readiness probe fails
+var cacheReady atomic.Bool
+
+// wait for the cache backend to answer, giving up and exiting after the
+// configured maximum wait so the orchestrator can restart us. A maximum
+// wait of 0 means we keep trying forever.
+func waitForCache() {
+	ctx := context.Background()
+	if config.getCacheConnectMaxWait() > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(config.getCacheConnectMaxWait())*time.Second)
+		defer cancel()
+	}
+
+	err := redisCache.WaitForStore(ctx, rdb,
+		milliseconds(config.getCacheConnectMinBackoff()),
+		milliseconds(config.getCacheConnectMaxBackoff()),
+	)
+	if err != nil {
+		klog.Errorf("Error connecting to [%s] cache backend", config.getCacheBackend())
+		klog.Errorf("Configuration:\n==========\n[%+v]\n", config.redact())
+		klog.Fatal(err)
 	}
+
+	cacheReady.Store(true)
+	klog.Infof("Connected to [%s] cache backend and received pong when testing the connection", config.getCacheBackend())
 }
 
 // this is the place we actually start the server.
@@ -230,61 +348,204 @@ func Run() {
 	// first thing's first, lets load our configuration using the config.go
 	// interface we defined for our server.
 	config = newConfig()
+	if err := config.validate(); err != nil {
+		klog.Fatal(err)
+	}
+
+	// set up tracing before anything else, so the cache backend we
+	// connect to next knows whether to trace its commands
+	if err := setupTracing(context.Background()); err != nil {
+		klog.Errorf("Error configuring [%s] tracing exporter", config.getTracingExporter())
+		klog.Fatal(err)
+	}
+
+	// load the API keys callers have to present. With none configured,
+	// and no JWT validation either, the API stays open the way it's
+	// always been
+	var err error
+	apiKeys, err = newAPIKeyStore(config.getAPIKeysFile(), config.getAPIKeys())
+	if err != nil {
+		klog.Error("Error loading API keys")
+		klog.Fatal(err)
+	}
+	if apiKeys != nil && config.getAPIKeysFile() != "" {
+		go apiKeys.watch(time.Duration(config.getAPIKeysReloadInterval()) * time.Second)
+	}
+
+	// and the JWTs our SSO hands out, which callers can send instead
+	tokens, err = newTokenValidator(context.Background())
+	if err != nil {
+		klog.Error("Error configuring JWT validation")
+		klog.Fatal(err)
+	}
+
+	if apiKeys == nil && tokens == nil {
+		klog.Warning("No API keys or JWT validation are configured; every endpoint is open to anyone who can reach the port")
+	}
+
+	// once we know who callers are, the key policy decides which keys
+	// each of them may touch, so teams sharing us can't clobber each other
+	keyPolicy, err = loadKeyPolicy(config.getKeyPolicyFile())
+	if err != nil {
+		klog.Error("Error loading key policy")
+		klog.Fatal(err)
+	}
 
 	// next, we need to define some endpoints for the server to handle
 	// in this we're binding a specific endpoint (the string parameter)
 	// to a specific handler function. You can either define the function
 	// inline, or create a separate one. Because I feel it creates a
 	// more readable piece of code, I've elected to define separate
-	// functions for each endpoint handler.
-	http.HandleFunc("/ping", pingHandler)
-	http.HandleFunc("/healthz", readyzHandler)
-	http.HandleFunc("/debug", debugHandler)
+	// functions for each endpoint handler. Probes and metrics are
+	// scraped by the platform, so they never need an API key.
+	handleFunc("/ping", requireScope(scope(scopeRead), rateLimited("/ping", pingHandler)))
+	handleFunc("/livez", probeHandler("liveness", livenessChecks))
+	handleFunc("/readyz", probeHandler("readiness", readinessChecks))
+	// /healthz predates the split and has always meant "ready", so it
+	// stays that way for anyone still pointing a probe at it
+	handleFunc("/healthz", probeHandler("readiness", readinessChecks))
+	// /debug shows our config and Redis internals, so it's off unless
+	// someone asks for it, and should sit behind a token or an admin key
+	// when it's on. It checks both itself rather than going through
+	// requireScope, which would turn the debug token away as an unknown
+	// API key.
+	handleFunc("/debug", rateLimited("/debug", debugHandler))
+	if config.getDebugEnabled() && config.getDebugToken() == "" && apiKeys == nil && tokens == nil {
+		klog.Warning("The /debug endpoint is enabled without a debug token; anyone who can reach the port can read it")
+	}
+	handleFunc("/metrics", promhttp.Handler().ServeHTTP)
 
-	// these two handlers are going to do some BS work against our Redis
-	// implementations. Sending a request to write-redis will
-	http.HandleFunc("/write-redis", makeWorkHandler)
-	http.HandleFunc("/read-redis", readCacheHandler)
+	// the versioned, resource-style API for keys; the key is taken from
+	// the path and the HTTP method decides what we do with it
+	handleFunc(keysPath, requireScope(methodScope, rateLimited(keysPath, keysHandler)))
 
-	// next, lets start our Redis connection!
-	opts := redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", config.getRedisAddress(), config.getRedisPort()),
-		Password: config.getRedisPassword(),
-		DB:       config.getRedisDB(),
-	}
+	// many keys in one request, split up by cluster slot where needed
+	handleFunc(batchGetPath, requireScope(scope(scopeRead), rateLimited(batchGetPath, batchGetHandler)))
+	handleFunc(batchDeletePath, requireScope(scope(scopeWrite), rateLimited(batchDeletePath, batchDeleteHandler)))
 
-	// create the new database; note how we have to create var err
-	// or we will lose rdb as the global variable and have only a
-	// variable scoped to our function. Fuckery, I say... :P
-	var err error
-	rdb, err = redisCache.NewRedisDatabase(&opts, &ctx)
+	// a rate limiter other services can ask whether a client may do
+	// something, with the limits shared through Redis
+	handleFunc(ratelimitPath, requireScope(scope(scopeWrite), rateLimited(ratelimitPath, ratelimitHandler)))
+
+	// distributed locks with fencing tokens, for callers that need one
+	// of something across all their replicas
+	handleFunc(locksPath, requireScope(scope(scopeWrite), rateLimited(locksPath, locksHandler)))
+
+	// counters that callers add to in one step, rather than reading a
+	// key, adding to it and writing it back
+	handleFunc(countersPath, requireScope(scope(scopeWrite), rateLimited(countersPath, countersHandler)))
 
+	// hashes, so one field of a stored object can change without
+	// rewriting the rest of it
+	handleFunc(hashesPath, requireScope(methodScope, rateLimited(hashesPath, hashesHandler)))
+
+	// these two handlers are going to do some BS work against our Redis
+	// implementations. Sending a request to write-redis will. They're the
+	// legacy API now, kept around until callers move over to /v1/keys
+	handleFunc("/write-redis", deprecated(requireScope(scope(scopeWrite), rateLimited("/write-redis", makeWorkHandler))))
+	handleFunc("/read-redis", deprecated(requireScope(scope(scopeRead), rateLimited("/read-redis", readCacheHandler))))
+
+	// next, lets set up our cache backend! Redis is the real thing,
+	// but developers can run against an in-memory store instead
+	rdb, err = newStore()
 	if err != nil {
-		klog.Errorf("Error encountered connecting to Redis cache.")
-		klog.Errorf("Configuration:\n==========\n[%+v]\n", config)
-		klog.Errorf("Redis options:\n==========\n[%+v]\n", opts)
+		klog.Errorf("Error encountered setting up [%s] cache backend.", config.getCacheBackend())
+		klog.Errorf("Configuration:\n==========\n[%+v]\n", config.redact())
 		klog.Fatal(err)
 	}
 
-	// I know we don't need to ping here because we're doing it at
-	// object creation, but it still gives me comfort to know we can
-	_, err = rdb.Ping()
+	// Redis may well not be up yet - in docker-compose or Kubernetes we
+	// often start first - so rather than crash, we start serving straight
+	// away and keep trying in the background; readiness fails until then
+	go waitForCache()
+
+	// rate limits and quotas live either in this process or, so every
+	// replica enforces the same limits, in Redis next to everything else
+	rateLimits, err = parseRateLimits(config.getRateLimits())
 	if err != nil {
-		klog.Errorf("Error pinging Redis cache")
-		klog.Errorf("Configuration:\n==========\n[%+v]\n", config)
-		klog.Errorf("Redis options:\n==========\n[%+v]\n", opts)
 		klog.Fatal(err)
-	} else {
-		klog.Infof("Connected to Redis database and received pong when testing the connection")
+	}
+	limiter, err = newLimiter()
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	// the connection pool only exists for the Redis backend, so that's
+	// the only time we have pool stats to export
+	if db, ok := rdb.(*redisCache.Database); ok {
+		prometheus.MustRegister(redisCache.NewPoolStatsCollector(db))
 	}
 
+	// every request gets a request ID, so errors we send back can be
+	// matched up with our logs, and then passes through withClientIdentity
+	// so handlers can find out who verified client certificates say
+	// they're talking to
 	server := &http.Server{
-		Addr: fmt.Sprintf(":%d", config.getPort()),
+		Addr:    fmt.Sprintf(":%d", config.getPort()),
+		Handler: withRequestID(withClientIdentity(http.DefaultServeMux)),
 	}
 
-	err = server.ListenAndServe()
+	// each listener runs in its own goroutine and reports back here if
+	// it stops for any reason other than us shutting it down
+	servers := []*http.Server{server}
+	serveErrors := make(chan error, 2)
+
+	// if we've been given a certificate and key, serve HTTPS; otherwise
+	// we fall back to plain HTTP like we always have
+	if config.getCertFile() != "" && config.getKeyFile() != "" {
+		reloader, err := newCertReloader(config.getCertFile(), config.getKeyFile())
+		if err != nil {
+			klog.Errorf("Error loading certificate [%s] and key [%s]", config.getCertFile(), config.getKeyFile())
+			klog.Fatal(err)
+		}
+		go reloader.watch(time.Duration(config.getCertReloadInterval()) * time.Second)
 
-	if err != nil {
+		server.TLSConfig, err = newTLSConfig(reloader, config.getClientAuth(), config.getClientCAFile())
+		if err != nil {
+			klog.Errorf("Error configuring TLS with client auth [%s] and client CA file [%s]", config.getClientAuth(), config.getClientCAFile())
+			klog.Fatal(err)
+		}
+
+		// optionally run a plain HTTP listener that does nothing but
+		// point callers at the HTTPS one
+		if config.getRedirectPort() != 0 {
+			redirect := &http.Server{
+				Addr:    fmt.Sprintf(":%d", config.getRedirectPort()),
+				Handler: http.HandlerFunc(redirectHandler),
+			}
+			servers = append(servers, redirect)
+			klog.Infof("Redirecting HTTP requests on port %d to HTTPS", config.getRedirectPort())
+			go func() {
+				serveErrors <- redirect.ListenAndServe()
+			}()
+		}
+
+		klog.Infof("Serving HTTPS on port %d", config.getPort())
+		go func() {
+			serveErrors <- server.ListenAndServeTLS("", "")
+		}()
+	} else {
+		if config.getClientAuth() != "" && config.getClientAuth() != "none" {
+			klog.Warningf("Client auth mode [%s] is ignored without a certificate and key to serve HTTPS", config.getClientAuth())
+		}
+		klog.Infof("Serving HTTP on port %d", config.getPort())
+		go func() {
+			serveErrors <- server.ListenAndServe()
+		}()
+	}
+
+	// now we wait - either a listener falls over, in which case there's
+	// nothing left to do but exit, or we get told to stop and shut down
+	// cleanly so in-flight requests get to finish
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+
+	select {
+	case err := <-serveErrors:
 		klog.Fatal(err)
+	case sig := <-stop:
+		klog.Infof("Received signal [%s], shutting down...", sig)
 	}
+
+	shutdown(servers)
 }
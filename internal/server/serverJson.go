@@ -19,6 +19,7 @@ import (
 type malformedRequest struct {
 	status int
 	msg    string
+	field  string
 }
 
 // a function for our malformedRequest errors to return the error
@@ -82,8 +83,8 @@ func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) err
 		// type assignment; for example, if we're assigning a String to
 		// an Int value in our Struct.
 		case errors.As(err, &unmarshalTypeError):
-			msg := fmt.Sprintf("request body contains badly-formed JSON")
-			return &malformedRequest{status: http.StatusBadRequest, msg: msg}
+			msg := fmt.Sprintf("Request body contains an invalid value for the %q field (at position %d)", unmarshalTypeError.Field, unmarshalTypeError.Offset)
+			return &malformedRequest{status: http.StatusBadRequest, msg: msg, field: unmarshalTypeError.Field}
 
 		// Catch the error caused by unexpected fields in the request body
 		// Extract the field anme from the error message and include it in
@@ -92,7 +93,7 @@ func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) err
 		case strings.HasPrefix(err.Error(), "json: unknown field "):
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
 			msg := fmt.Sprintf("Request body contains unknown field %s", fieldName)
-			return &malformedRequest{status: http.StatusBadRequest, msg: msg}
+			return &malformedRequest{status: http.StatusBadRequest, msg: msg, field: strings.Trim(fieldName, "\"")}
 
 		// an io.EOF error is returned by Decode() if the request body is
 		// empty.
@@ -144,3 +145,14 @@ func encodeJSONBody(w http.ResponseWriter, dst interface{}) error {
 	// no errors, so we can safely return nil
 	return nil
 }
+
+// look for a ?default= query parameter on the request; the second
+// return value is false if the caller didn't send one at all, which
+// lets an explicit ?default= (an empty string) still count
+func defaultValue(r *http.Request) (string, bool) {
+	query := r.URL.Query()
+	if !query.Has("default") {
+		return "", false
+	}
+	return query.Get("default"), true
+}
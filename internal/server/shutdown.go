@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// flipped to true as soon as we're asked to stop; the readiness probe
+// checks it so Kubernetes takes us out of the Service before we close
+// any listeners
+var shuttingDown atomic.Bool
+
+// shut the server down in the order Kubernetes needs for a rolling
+// deploy not to drop writes:
+//
+//  1. fail the readiness probe so no new traffic gets routed to us
+//  2. wait out the drain period while endpoints catch up
+//  3. stop the listeners and let in-flight requests finish, up to
+//     the shutdown timeout
+//  4. flush any spans we haven't exported yet
+//  5. close the Redis connection pool, since nothing is using it anymore
+func shutdown(servers []*http.Server) {
+	shuttingDown.Store(true)
+
+	drain := time.Duration(config.getDrainPeriod()) * time.Second
+	klog.Infof("Failing readiness probes and draining connections for %v...", drain)
+	time.Sleep(drain)
+
+	timeout := time.Duration(config.getShutdownTimeout()) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	klog.Infof("Waiting up to %v for in-flight requests to finish...", timeout)
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s *http.Server) {
+			defer wg.Done()
+			if err := s.Shutdown(ctx); err != nil {
+				klog.Errorf("Error shutting down listener on [%s]: %s", s.Addr, err.Error())
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	if tracerProvider != nil {
+		if err := tracerProvider.Shutdown(ctx); err != nil {
+			klog.Errorf("Error flushing traces: %s", err.Error())
+		}
+	}
+
+	if rdb != nil {
+		if err := rdb.Close(); err != nil {
+			klog.Errorf("Error closing Redis connection: %s", err.Error())
+		}
+	}
+
+	klog.Info("Shutdown complete")
+	klog.Flush()
+}
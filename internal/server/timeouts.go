@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	redisCache "github.com/blomquistr/go-redis-example/v2/internal/cache"
+	"k8s.io/klog"
+)
+
+// nginx's non-standard status for a caller that hung up before we could
+// answer; nobody will see the response, but our logs and metrics will
+const statusClientClosedRequest = 499
+
+// a context for a cache read made on behalf of r. It's cancelled when the
+// caller goes away, and gives up after the configured read timeout so a
+// slow Redis can't hold the request open forever.
+func readContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), time.Duration(config.getCacheReadTimeout())*time.Millisecond)
+}
+
+// the same as readContext, but for writes, which get their own timeout
+func writeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), time.Duration(config.getCacheWriteTimeout())*time.Millisecond)
+}
+
+// report whether a cache call failed because it ran out of time, either
+// our per-operation deadline or a network timeout inside the client
+func isTimeout(ctx context.Context, err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// report whether a cache call failed because the caller disconnected
+func isCanceled(r *http.Request, err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(r.Context().Err(), context.Canceled)
+}
+
+// pick the status code for an error from a cache call made with ctx
+func cacheErrorStatus(r *http.Request, ctx context.Context, err error) int {
+	switch {
+	case isCanceled(r, err):
+		return statusClientClosedRequest
+	case isTimeout(ctx, err):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// turn an error from a cache call made with ctx into a problem: a 409
+// if the key holds a different kind of value than the caller's endpoint
+// works on, a 504 if the cache took too long, a 499 if the caller gave up
+// on us first, and a sanitized 500 for anything else
+func writeCacheError(w http.ResponseWriter, r *http.Request, ctx context.Context, err error) {
+	requestID := requestIDFromContext(r.Context())
+
+	// e.g. GET /v1/keys on a hash; that's the caller's mistake, not ours
+	var wrongType *redisCache.WrongTypeError
+	if errors.As(err, &wrongType) {
+		writeProblem(w, r, Problem{
+			Type:   problemTypeWrongType,
+			Title:  "Wrong type",
+			Status: http.StatusConflict,
+			Detail: fmt.Sprintf("Key [%s] holds a different kind of value than this endpoint works with", wrongType.Key),
+			Key:    wrongType.Key,
+		})
+		return
+	}
+
+	switch cacheErrorStatus(r, ctx, err) {
+	case statusClientClosedRequest:
+		klog.Infof("Caller went away before request [%s] finished: %s", requestID, err.Error())
+		writeProblem(w, r, Problem{
+			Title:  "Client Closed Request",
+			Status: statusClientClosedRequest,
+		})
+	case http.StatusGatewayTimeout:
+		klog.Warningf("Cache timed out handling request [%s]: %s", requestID, err.Error())
+		writeProblem(w, r, Problem{
+			Type:   problemTypeCacheTimeout,
+			Title:  "Cache timeout",
+			Status: http.StatusGatewayTimeout,
+			Detail: "The cache did not respond in time",
+		})
+	default:
+		writeInternalError(w, r, err)
+	}
+}
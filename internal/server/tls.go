@@ -0,0 +1,242 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// a struct that holds the currently loaded TLS certificate and knows
+// where it came from on disk. Tools like cert-manager rewrite the cert
+// and key files in place when they rotate them, so rather than loading
+// the pair once at startup we keep checking the files and swap in the
+// new certificate whenever they change.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certInfo os.FileInfo
+	keyInfo  os.FileInfo
+}
+
+// create a new certReloader and load the certificate pair for the first
+// time; if we can't load the pair at startup there's no point in going
+// any further, so the error is returned to the caller
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	cr := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// load the certificate pair from disk and swap it in for the current one
+func (cr *certReloader) reload() error {
+	certInfo, err := os.Stat(cr.certFile)
+	if err != nil {
+		return err
+	}
+
+	keyInfo, err := os.Stat(cr.keyFile)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.cert = &cert
+	cr.certInfo = certInfo
+	cr.keyInfo = keyInfo
+
+	return nil
+}
+
+// report whether either file on disk looks different from the one we
+// last loaded; we compare size and modification time because that's
+// enough to notice an in-place rewrite without hashing the files
+func (cr *certReloader) changed() bool {
+	certInfo, err := os.Stat(cr.certFile)
+	if err != nil {
+		return false
+	}
+
+	keyInfo, err := os.Stat(cr.keyFile)
+	if err != nil {
+		return false
+	}
+
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	return !sameFile(cr.certInfo, certInfo) || !sameFile(cr.keyInfo, keyInfo)
+}
+
+func sameFile(a os.FileInfo, b os.FileInfo) bool {
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// poll the certificate files every interval and reload them when they
+// change. A failed reload keeps serving the old certificate - the files
+// are often written one after the other, so a mismatched pair is usually
+// fixed by the next tick.
+func (cr *certReloader) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !cr.changed() {
+			continue
+		}
+
+		klog.Info("Certificate files changed on disk, reloading...")
+		if err := cr.reload(); err != nil {
+			klog.Errorf("Error reloading certificate, keeping the previous one: %s", err.Error())
+			continue
+		}
+		klog.Info("Reloaded certificate")
+	}
+}
+
+// the callback handed to tls.Config; it's called on every handshake, so
+// it only ever reads the certificate that watch() has already loaded
+func (cr *certReloader) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// translate the server.client-auth setting into the tls package's
+// ClientAuthType. We only offer modes that verify the certificate against
+// our CA bundle - a client certificate we can't trust is no identity at all.
+func parseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch strings.ToLower(mode) {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("Invalid client auth mode [%s], supported modes are [none request require]", mode)
+	}
+}
+
+// read a PEM bundle of CA certificates to verify peer certificates with
+func loadCAFile(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificates found in CA file [%s]", caFile)
+	}
+
+	return pool, nil
+}
+
+// build the TLS configuration for our server around a certReloader; when
+// client authentication is turned on we also need the CA bundle to check
+// client certificates against
+func newTLSConfig(cr *certReloader, clientAuth string, clientCAFile string) (*tls.Config, error) {
+	authType, err := parseClientAuth(clientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cr.getCertificate,
+		ClientAuth:     authType,
+	}
+
+	if authType == tls.NoClientCert {
+		return tlsConfig, nil
+	}
+
+	if clientCAFile == "" {
+		return nil, fmt.Errorf("Client auth mode [%s] requires a client CA file", clientAuth)
+	}
+
+	tlsConfig.ClientCAs, err = loadCAFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return tlsConfig, nil
+}
+
+// build the TLS configuration for our connection to Redis, or nil when
+// Redis TLS is turned off. Managed Redis offerings mostly use certificates
+// from a public CA, so the CA file is optional and falls back on the
+// system roots; a client certificate is only needed if Redis asks for one.
+func newRedisTLSConfig() (*tls.Config, error) {
+	if !config.getRedisTLSEnabled() {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         config.getRedisTLSServerName(),
+		InsecureSkipVerify: config.getRedisTLSInsecureSkipVerify(),
+	}
+
+	if config.getRedisTLSInsecureSkipVerify() {
+		klog.Warning("Redis TLS certificate verification is turned off; never do this outside of development")
+	}
+
+	if config.getRedisTLSCAFile() != "" {
+		pool, err := loadCAFile(config.getRedisTLSCAFile())
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.getRedisTLSCertFile() != "" || config.getRedisTLSKeyFile() != "" {
+		cert, err := tls.LoadX509KeyPair(config.getRedisTLSCertFile(), config.getRedisTLSKeyFile())
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// function to send plain HTTP callers over to the HTTPS listener; we keep
+// the host and path the caller asked for and only swap the scheme and port
+func redirectHandler(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+	}
+
+	if config.getPort() != 443 {
+		host = net.JoinHostPort(host, fmt.Sprintf("%d", config.getPort()))
+	}
+
+	target := fmt.Sprintf("https://%s%s", host, r.URL.RequestURI())
+	http.Redirect(w, r, target, http.StatusPermanentRedirect)
+}
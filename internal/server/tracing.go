@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the instrumentation name our server spans are reported under
+const tracerName = "github.com/blomquistr/go-redis-example/v2/internal/server"
+
+// the tracer provider we set up in Run, kept around so shutdown can
+// flush any spans still waiting to be exported; nil when tracing is off
+var tracerProvider *sdktrace.TracerProvider
+
+// build the span exporter selected by server.tracing-exporter. OTLP is
+// what we run with for real; stdout and file are for looking at traces
+// locally without standing up a collector.
+func newSpanExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	switch config.getTracingExporter() {
+	case "otlp":
+		return otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(config.getTracingEndpoint()))
+	case "stdout":
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "file":
+		f, err := os.OpenFile(config.getTracingFile(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return stdouttrace.New(stdouttrace.WithWriter(f))
+	default:
+		return nil, fmt.Errorf("Invalid tracing exporter [%s], supported exporters are [none otlp stdout file]", config.getTracingExporter())
+	}
+}
+
+// set up the global tracer provider and W3C trace context propagation.
+// With the exporter set to none we still install the propagator, so an
+// incoming traceparent is at least passed along, but we record nothing.
+func setupTracing(ctx context.Context) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if config.getTracingExporter() == "" || config.getTracingExporter() == "none" {
+		return nil
+	}
+
+	exporter, err := newSpanExporter(ctx)
+	if err != nil {
+		return err
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", configPrefix),
+		)),
+	)
+	otel.SetTracerProvider(tracerProvider)
+
+	return nil
+}
+
+// a ResponseWriter that remembers the status code the handler sent, so
+// we can put it on the span once the handler is done
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// wrap a handler in a server span. If the caller sent a traceparent
+// header the span joins their trace, otherwise it starts a new one; the
+// handler gets the span in its request context, which is what lets the
+// cache calls it makes show up as children. We record the route and not
+// the path, which for most of our API has the key in it, and the key
+// shouldn't end up in traces when server.tracing-hash-keys is on.
+func traceHandler(route string, handler http.Handler) http.Handler {
+	tracer := otel.Tracer(tracerName)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, fmt.Sprintf("%s %s", r.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("http.request_id", requestIDFromContext(r.Context())),
+			),
+		)
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
@@ -0,0 +1,43 @@
+# Shared setup for the manual tests; source it at the top of a script run
+# from the repository root. It makes a work directory, builds the app into
+# it and arranges for everything started with start_app, or added to PIDS,
+# to be stopped when the script exits.
+
+WORKDIR=$(mktemp -d)
+PIDS=()
+
+cleanup() {
+  kill "${PIDS[@]}" 2>/dev/null || true
+  # the app drains for a few seconds before it lets go of the port, so
+  # wait for it rather than leave the next script talking to this one
+  wait "${PIDS[@]}" 2>/dev/null || true
+  rm -rf "$WORKDIR"
+}
+trap cleanup EXIT
+
+# build the app rather than go run it; go run leaves the compiled binary
+# running, still holding the port, when only the go tool gets killed
+go build -o "$WORKDIR/app" .
+
+# start_app [NAME=value...]: run the app with the given environment,
+# logging to $WORKDIR/app.log, and wait until it answers /livez
+start_app() {
+  env "$@" "$WORKDIR/app" >"$WORKDIR/app.log" 2>&1 &
+  local pid=$!
+  PIDS+=("$pid")
+
+  for _ in $(seq 1 60); do
+    if curl -sf -o /dev/null http://localhost:5678/livez; then
+      return 0
+    fi
+    if ! kill -0 "$pid" 2>/dev/null; then
+      echo "the app exited before it was ready:"
+      cat "$WORKDIR/app.log"
+      exit 1
+    fi
+    sleep 0.5
+  done
+
+  echo "the app wasn't ready after 30 seconds"
+  exit 1
+}
@@ -0,0 +1,61 @@
+#!/usr/bin/env bash
+# Manual test for the /v1/locks API. Starts redis-server and the app, then
+# checks that a lock expires and the next owner gets a larger fencing
+# token, that only the owner can release a lock, and that exactly one of
+# a crowd of concurrent acquirers wins. Needs redis-server on the PATH;
+# run it from the repository root.
+set -euo pipefail
+
+source "$(dirname "$0")/lib.sh"
+
+URL=http://localhost:5678/v1/locks
+
+redis-server --port 6394 --save "" --daemonize no >"$WORKDIR/redis.log" 2>&1 &
+PIDS+=($!)
+
+sleep 1
+
+start_app REDISTESTER_SERVER_REDIS_PORT=6394
+
+# POST a lock request, printing the status code and leaving the body in
+# $WORKDIR/body
+acquire() {
+  curl -s -o "$WORKDIR/body" -w '%{http_code}' -X POST -H 'Content-Type: application/json' \
+    -d "{\"owner\":\"$2\",\"ttl\":$3}" "$URL/$1"
+}
+
+token() {
+  sed -E 's/.*"token":([0-9]+).*/\1/' "$WORKDIR/body"
+}
+
+echo "Expiry: a lock that isn't extended is free again after its TTL..."
+[ "$(acquire expiry alice 1)" = 200 ] || { echo "alice should get the lock"; exit 1; }
+first=$(token)
+[ "$(acquire expiry bob 1)" = 409 ] || { echo "bob shouldn't get the lock while alice holds it"; exit 1; }
+sleep 2
+[ "$(acquire expiry bob 1)" = 200 ] || { echo "bob should get the lock once it expires"; exit 1; }
+second=$(token)
+[ "$second" -gt "$first" ] || { echo "bob's token [$second] should be larger than alice's [$first]"; exit 1; }
+echo "ok, tokens went from $first to $second"
+
+echo "Owner mismatch: only the owner can release a lock..."
+[ "$(acquire mismatch alice 30)" = 200 ] || { echo "alice should get the lock"; exit 1; }
+code=$(curl -s -o /dev/null -w '%{http_code}' -X DELETE -H 'X-Lock-Owner: bob' "$URL/mismatch")
+[ "$code" = 409 ] || { echo "bob's release should be refused, got $code"; exit 1; }
+code=$(curl -s -o /dev/null -w '%{http_code}' -X DELETE -H 'X-Lock-Owner: alice' "$URL/mismatch")
+[ "$code" = 204 ] || { echo "alice's release should work, got $code"; exit 1; }
+code=$(curl -s -o /dev/null -w '%{http_code}' -X DELETE -H 'Content-Type: application/json' -d '{"owner":"alice"}' "$URL/mismatch")
+[ "$code" = 404 ] || { echo "releasing a released lock should be 404, got $code"; exit 1; }
+echo "ok"
+
+echo "Concurrency: exactly one of 20 acquirers gets the lock..."
+CURLS=()
+for i in $(seq 1 20); do
+  curl -s -o /dev/null -w '%{http_code}\n' -X POST -H 'Content-Type: application/json' \
+    -d "{\"owner\":\"worker-$i\",\"ttl\":30}" "$URL/crowd" >"$WORKDIR/crowd-$i" &
+  CURLS+=($!)
+done
+wait "${CURLS[@]}"
+winners=$(cat "$WORKDIR"/crowd-* | grep -c '^200$' || true)
+[ "$winners" = 1 ] || { echo "expected exactly one winner, got $winners"; exit 1; }
+echo "ok"
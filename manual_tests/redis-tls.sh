@@ -0,0 +1,56 @@
+#!/usr/bin/env bash
+# Manual test for TLS and ACL users on the Redis connection. Generates a
+# throwaway CA, a server certificate for redis-server and a client
+# certificate for the app, starts redis-server with TLS only and an ACL
+# user, then writes and reads a key through the app. Needs openssl,
+# redis-server (built with TLS support) and curl on the PATH; run it from
+# the repository root.
+set -euo pipefail
+
+source "$(dirname "$0")/lib.sh"
+
+cd "$WORKDIR"
+
+echo "Generating a CA and certificates..."
+openssl req -x509 -newkey rsa:2048 -nodes -days 1 -subj "/CN=redistester-test-ca" \
+  -keyout ca.key -out ca.pem 2>/dev/null
+
+openssl req -newkey rsa:2048 -nodes -subj "/CN=redis" -keyout redis.key -out redis.csr 2>/dev/null
+printf "subjectAltName=DNS:localhost,IP:127.0.0.1\n" >redis.ext
+openssl x509 -req -days 1 -in redis.csr -CA ca.pem -CAkey ca.key -CAcreateserial \
+  -extfile redis.ext -out redis.pem 2>/dev/null
+
+openssl req -newkey rsa:2048 -nodes -subj "/CN=redistester" -keyout client.key -out client.csr 2>/dev/null
+openssl x509 -req -days 1 -in client.csr -CA ca.pem -CAkey ca.key -CAcreateserial \
+  -out client.pem 2>/dev/null
+
+cd - >/dev/null
+
+echo "Starting redis-server with TLS and an ACL user..."
+redis-server --port 0 --tls-port 6389 --save "" \
+  --tls-cert-file "$WORKDIR/redis.pem" --tls-key-file "$WORKDIR/redis.key" \
+  --tls-ca-cert-file "$WORKDIR/ca.pem" --tls-auth-clients yes \
+  --user default off --user "app on >app-password ~* +@all" \
+  >"$WORKDIR/redis.log" 2>&1 &
+PIDS+=($!)
+
+sleep 1
+
+start_app \
+  REDISTESTER_SERVER_REDIS_ADDRESS=localhost \
+  REDISTESTER_SERVER_REDIS_PORT=6389 \
+  REDISTESTER_SERVER_REDIS_USERNAME=app \
+  REDISTESTER_SERVER_REDIS_PASSWORD=app-password \
+  REDISTESTER_SERVER_REDIS_TLS_ENABLED=true \
+  REDISTESTER_SERVER_REDIS_TLS_CA_FILE="$WORKDIR/ca.pem" \
+  REDISTESTER_SERVER_REDIS_TLS_CERT_FILE="$WORKDIR/client.pem" \
+  REDISTESTER_SERVER_REDIS_TLS_KEY_FILE="$WORKDIR/client.key"
+
+echo "Writing a key over TLS..."
+curl -sf -X PUT -H 'Content-Type: application/json' -d '{"value":"over tls","ttl":60}' \
+  http://localhost:5678/v1/keys/tls-test
+echo
+
+echo "Reading it back..."
+curl -sf http://localhost:5678/v1/keys/tls-test
+echo
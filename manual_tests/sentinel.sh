@@ -0,0 +1,49 @@
+#!/usr/bin/env bash
+# Manual failover test for Sentinel mode. Starts a master, a replica and
+# three sentinels with redis-server, points the app at the sentinels,
+# writes a key, forces a failover and reads the key back from the new
+# master. Needs redis-server and redis-cli on the PATH; run it from the
+# repository root.
+set -euo pipefail
+
+source "$(dirname "$0")/lib.sh"
+
+redis-server --port 6390 --save "" --daemonize no >"$WORKDIR/master.log" 2>&1 &
+PIDS+=($!)
+redis-server --port 6391 --save "" --replicaof 127.0.0.1 6390 --daemonize no >"$WORKDIR/replica.log" 2>&1 &
+PIDS+=($!)
+
+for port in 26390 26391 26392; do
+  cat >"$WORKDIR/sentinel-$port.conf" <<CONF
+port $port
+sentinel monitor mymaster 127.0.0.1 6390 2
+sentinel down-after-milliseconds mymaster 1000
+sentinel failover-timeout mymaster 5000
+CONF
+  redis-server "$WORKDIR/sentinel-$port.conf" --sentinel >"$WORKDIR/sentinel-$port.log" 2>&1 &
+  PIDS+=($!)
+done
+
+sleep 2
+
+start_app \
+  REDISTESTER_SERVER_REDIS_MODE=sentinel \
+  REDISTESTER_SERVER_REDIS_MASTER_NAME=mymaster \
+  REDISTESTER_SERVER_REDIS_SENTINEL_ADDRESSES=127.0.0.1:26390,127.0.0.1:26391,127.0.0.1:26392
+
+echo "Writing a key through the original master..."
+curl -sf -X PUT -H 'Content-Type: application/json' -d '{"value":"before failover","ttl":300}' \
+  http://localhost:5678/v1/keys/failover-test
+echo
+
+echo "Forcing a failover..."
+redis-cli -p 26390 sentinel failover mymaster
+sleep 5
+
+echo "Reading the key back from the new master..."
+curl -sf http://localhost:5678/v1/keys/failover-test
+echo
+
+echo "Master changes seen by the app:"
+curl -sf http://localhost:5678/metrics | grep redistester_redis_master_changes_total
+grep "Sentinel master" "$WORKDIR/app.log"